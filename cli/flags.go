@@ -1 +1,41 @@
 package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// KeyValueFlag collects repeated KEY=VALUE flags, like docker build --build-arg
+// A bare KEY takes its value from the environment, also like Docker
+type KeyValueFlag map[string]string
+
+// String returns the collected pairs in a stable order
+func (f KeyValueFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set parses a single KEY=VALUE occurrence
+func (f KeyValueFlag) Set(value string) error {
+	key, val, found := strings.Cut(value, "=")
+	if key == "" {
+		return fmt.Errorf("invalid value %q (expected KEY=VALUE)", value)
+	}
+
+	if !found {
+		envVal, ok := os.LookupEnv(key)
+		if !ok {
+			return nil
+		}
+		val = envVal
+	}
+
+	f[key] = val
+	return nil
+}
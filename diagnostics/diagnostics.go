@@ -0,0 +1,146 @@
+package diagnostics
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity classifies a diagnostic
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+// String returns the lower-case severity name used in messages
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Position points at the Dockerfile lines a diagnostic is about
+// The zero Position means the diagnostic is not tied to a line
+type Position struct {
+	File      string // Dockerfile path
+	StartLine int    // First line (1-based), 0 if unknown
+	EndLine   int    // Last line, may equal StartLine
+	Source    string // Original instruction text
+}
+
+// Diagnostic is a single message produced while converting a Dockerfile
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+	Position Position
+}
+
+// Location formats the position as "Dockerfile:42" or "Dockerfile:42-45"
+// Returns "" when the diagnostic has no position
+func (d Diagnostic) Location() string {
+	pos := d.Position
+	if pos.StartLine <= 0 {
+		return pos.File
+	}
+
+	file := pos.File
+	if file == "" {
+		file = "Dockerfile"
+	}
+	if pos.EndLine > pos.StartLine {
+		return fmt.Sprintf("%s:%d-%d", file, pos.StartLine, pos.EndLine)
+	}
+	return fmt.Sprintf("%s:%d", file, pos.StartLine)
+}
+
+// String formats the diagnostic like a compiler message: "Dockerfile:42: warning: ..."
+func (d Diagnostic) String() string {
+	if loc := d.Location(); loc != "" {
+		return fmt.Sprintf("%s: %s: %s", loc, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+}
+
+// Collector accumulates diagnostics in the order they are reported
+type Collector struct {
+	items []Diagnostic
+}
+
+// Add records a diagnostic
+func (c *Collector) Add(severity Severity, pos Position, format string, args ...interface{}) {
+	c.items = append(c.items, Diagnostic{
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+		Position: pos,
+	})
+}
+
+// Infof records an informational diagnostic, e.g. where a spec field came from
+func (c *Collector) Infof(pos Position, format string, args ...interface{}) {
+	c.Add(Info, pos, format, args...)
+}
+
+// Warnf records something that could not be translated automatically
+func (c *Collector) Warnf(pos Position, format string, args ...interface{}) {
+	c.Add(Warning, pos, format, args...)
+}
+
+// Errorf records a problem that makes the generated spec wrong
+func (c *Collector) Errorf(pos Position, format string, args ...interface{}) {
+	c.Add(Error, pos, format, args...)
+}
+
+// Items returns the recorded diagnostics
+func (c *Collector) Items() []Diagnostic {
+	if c == nil {
+		return nil
+	}
+	return c.items
+}
+
+// Count returns the number of diagnostics with the given severity
+func (c *Collector) Count(severity Severity) int {
+	n := 0
+	for _, d := range c.Items() {
+		if d.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// PrintDiagnostics prints warnings and errors, and info messages when verbose is set
+func PrintDiagnostics(c *Collector, verbose bool) {
+	items := c.Items()
+	if len(items) == 0 {
+		return
+	}
+
+	fmt.Println("=== DIAGNOSTICS ===")
+	for _, d := range items {
+		switch d.Severity {
+		case Error:
+			fmt.Printf("❌ %s\n", d)
+		case Warning:
+			fmt.Printf("⚠️  %s\n", d)
+		default:
+			if !verbose {
+				continue
+			}
+			fmt.Printf("ℹ️  %s\n", d)
+		}
+		if verbose && d.Position.Source != "" {
+			fmt.Printf("     %s\n", strings.TrimSpace(d.Position.Source))
+		}
+	}
+	fmt.Printf("\n%d error(s), %d warning(s)\n\n", c.Count(Error), c.Count(Warning))
+}
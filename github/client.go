@@ -2,13 +2,103 @@ package github
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"syscall"
 	"time"
 )
 
+// DefaultBaseURL is the API root of github.com
+const DefaultBaseURL = "https://api.github.com"
+
+// Client talks to the GitHub REST API of github.com or a GitHub Enterprise Server
+type Client struct {
+	BaseURL    string       // API root, e.g. https://ghe.example.com/api/v3 (default: DefaultBaseURL)
+	Token      string       // Personal access or app token, empty for unauthenticated requests
+	HTTPClient *http.Client // Default: 10s timeout
+
+	MaxRetries int                                 // Retries of 5xx responses, transient network errors and rate limits (default 3)
+	MaxWait    time.Duration                       // Longest wait before a retry; longer rate limits fail with ErrRateLimited (default 1m)
+	OnRetry    func(err error, wait time.Duration) // Called before each retry, e.g. to log it; may be nil
+}
+
+// retryBackoff is the wait before the first retry of a 5xx response, doubled for each further retry
+const retryBackoff = time.Second
+
+// sleep waits between retries
+var sleep = time.Sleep
+
+// NewClient creates a client for the API at baseURL ("" for github.com)
+func NewClient(baseURL, token string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		MaxRetries: 3,
+		MaxWait:    time.Minute,
+	}
+}
+
+// TokenFromEnv returns the token from GITHUB_TOKEN or, like the gh CLI, GH_TOKEN
+func TokenFromEnv() string {
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		return token
+	}
+	return os.Getenv("GH_TOKEN")
+}
+
+// ReadTokenFile reads a token from a file, ignoring surrounding whitespace
+func ReadTokenFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// WebURL returns the web root belonging to the API root:
+// https://api.github.com → https://github.com, https://ghe.example.com/api/v3 → https://ghe.example.com
+func (c *Client) WebURL() string {
+	base := strings.TrimSuffix(c.BaseURL, "/")
+	if base == "" || base == DefaultBaseURL {
+		return "https://github.com"
+	}
+	if trimmed := strings.TrimSuffix(base, "/api/v3"); trimmed != base {
+		return trimmed
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	u.Host = strings.TrimPrefix(u.Host, "api.")
+	u.Path = ""
+	return u.String()
+}
+
+// endpoint joins the API root and a path such as "repos/owner/repo"
+func (c *Client) endpoint(format string, args ...interface{}) string {
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	return strings.TrimSuffix(base, "/") + "/" + fmt.Sprintf(format, args...)
+}
+
 // RepoInfo contains metadata about a GitHub repository
 type RepoInfo struct {
 	Owner         string
@@ -18,32 +108,36 @@ type RepoInfo struct {
 	Website       string // Homepage URL
 	GitURL        string // Clone URL
 	License       string
-	LatestCommit  string
+	LatestCommit  string // Commit SHA being packaged (head of Ref)
 	DefaultBranch string
+	Ref           string // Branch or tag LatestCommit was resolved from
+	Version       string // Version from the release tag without the leading "v", empty for branches
 }
 
 // FetchRepoInfo fetches repository metadata from GitHub API
-func FetchRepoInfo(repoPath string) (*RepoInfo, error) {
-	owner, repo, err := parseRepoPath(repoPath)
+// opts selects the commit: a branch, tag or SHA, the latest release, or the default branch
+func (c *Client) FetchRepoInfo(repoPath string, opts FetchOptions) (*RepoInfo, error) {
+	owner, repo, err := c.parseRepoPath(repoPath)
 	if err != nil {
 		return nil, err
 	}
 
+	web := c.WebURL()
 	info := &RepoInfo{
 		Owner:    owner,
 		Repo:     repo,
 		FullName: fmt.Sprintf("%s/%s", owner, repo),
-		Website:  fmt.Sprintf("https://github.com/%s/%s", owner, repo),
-		GitURL:   fmt.Sprintf("https://github.com/%s/%s", owner, repo),
+		Website:  fmt.Sprintf("%s/%s/%s", web, owner, repo),
+		GitURL:   fmt.Sprintf("%s/%s/%s", web, owner, repo),
 	}
 
 	// Fetch repository metadata
-	if err := fetchRepoMetadata(info); err != nil {
+	if err := c.fetchRepoMetadata(info); err != nil {
 		return nil, fmt.Errorf("failed to fetch repo metadata: %w", err)
 	}
 
-	// Fetch latest commit
-	if err := fetchLatestCommit(info); err != nil {
+	// Resolve the commit to package
+	if err := c.resolveCommit(info, opts); err != nil {
 		return nil, fmt.Errorf("failed to fetch latest commit: %w", err)
 	}
 
@@ -52,7 +146,8 @@ func FetchRepoInfo(repoPath string) (*RepoInfo, error) {
 
 // parseRepoPath extracts owner and repo from various formats
 // Supports: "owner/repo", "https://github.com/owner/repo", "github.com/owner/repo"
-func parseRepoPath(path string) (owner, repo string, err error) {
+// and the same URLs on the client's GitHub Enterprise host
+func (c *Client) parseRepoPath(path string) (owner, repo string, err error) {
 	// Remove trailing slash
 	path = strings.TrimSuffix(path, "/")
 
@@ -60,6 +155,10 @@ func parseRepoPath(path string) (owner, repo string, err error) {
 	path = strings.TrimPrefix(path, "https://")
 	path = strings.TrimPrefix(path, "http://")
 	path = strings.TrimPrefix(path, "github.com/")
+	if u, err := url.Parse(c.WebURL()); err == nil && u.Host != "" {
+		path = strings.TrimPrefix(path, u.Host+"/")
+	}
+	path = strings.TrimSuffix(path, ".git")
 
 	// Split by /
 	parts := strings.Split(path, "/")
@@ -71,27 +170,10 @@ func parseRepoPath(path string) (owner, repo string, err error) {
 }
 
 // fetchRepoMetadata fetches repository information from GitHub API
-func fetchRepoMetadata(info *RepoInfo) error {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s", info.Owner, info.Repo)
-
-	resp, err := makeGitHubRequest(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("GitHub API error: %s - %s", resp.Status, string(body))
-	}
-
+func (c *Client) fetchRepoMetadata(info *RepoInfo) error {
 	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return fmt.Errorf("failed to parse JSON: %w", err)
+	if err := c.getJSON(c.endpoint("repos/%s/%s", info.Owner, info.Repo), &data); err != nil {
+		return err
 	}
 
 	// Extract metadata
@@ -119,55 +201,175 @@ func fetchRepoMetadata(info *RepoInfo) error {
 }
 
 // fetchLatestCommit fetches the latest commit SHA from the default branch
-func fetchLatestCommit(info *RepoInfo) error {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/commits/%s",
-		info.Owner, info.Repo, info.DefaultBranch)
+func (c *Client) fetchLatestCommit(info *RepoInfo) error {
+	var data map[string]interface{}
+	if err := c.getJSON(c.endpoint("repos/%s/%s/commits/%s", info.Owner, info.Repo, escapeRef(info.DefaultBranch)), &data); err != nil {
+		return err
+	}
+
+	if sha, ok := data["sha"].(string); ok {
+		info.LatestCommit = sha
+	} else {
+		return fmt.Errorf("commit SHA not found in response")
+	}
 
-	resp, err := makeGitHubRequest(url)
+	return nil
+}
+
+// getJSON fetches a GitHub API URL and decodes the JSON response into v
+func (c *Client) getJSON(apiURL string, v interface{}) error {
+	body, _, err := c.get(apiURL)
 	if err != nil {
 		return err
 	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return nil
+}
+
+// get fetches a GitHub API URL and returns the body and headers of the 200 response
+// 5xx responses, transient network errors and rate limits are retried (see retryDelay)
+func (c *Client) get(apiURL string) ([]byte, http.Header, error) {
+	for attempt := 0; ; attempt++ {
+		body, header, err := c.getOnce(apiURL)
+		if err == nil {
+			return body, header, nil
+		}
+
+		delay, retry := c.retryDelay(err, attempt)
+		if !retry {
+			return nil, nil, err
+		}
+		if c.OnRetry != nil {
+			c.OnRetry(err, delay)
+		}
+		sleep(delay)
+	}
+}
+
+// getOnce sends a single GET request with the proper headers and, if set, the token
+// Non-200 responses are returned as *APIError
+func (c *Client) getOnce(apiURL string) ([]byte, http.Header, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Add headers for GitHub API
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("User-Agent", "dalec-mapping-cli")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("GitHub API error: %s - %s", resp.Status, string(body))
+		return nil, nil, newAPIError(resp, apiURL, errorMessage(body))
 	}
+	return body, resp.Header, nil
+}
 
-	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return fmt.Errorf("failed to parse JSON: %w", err)
+// nextPage returns the URL of the next page from a Link header, "" on the last page:
+// <https://api.github.com/repositories/1/tags?page=2>; rel="next", <...>; rel="last"
+func nextPage(header http.Header) string {
+	for _, link := range strings.Split(header.Get("Link"), ",") {
+		target, params, ok := strings.Cut(link, ";")
+		if !ok {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
 	}
+	return ""
+}
 
-	if sha, ok := data["sha"].(string); ok {
-		info.LatestCommit = sha
-	} else {
-		return fmt.Errorf("commit SHA not found in response")
+// retryDelay decides whether a failed request is retried and how long to wait first
+//
+//	5xx, transient network exponential backoff: 1s, 2s, 4s, ...
+//	secondary rate limit   Retry-After, or a minute without it
+//	primary rate limit     until X-RateLimit-Reset
+//
+// Waits longer than MaxWait are not retried, the error is returned instead
+func (c *Client) retryDelay(err error, attempt int) (time.Duration, bool) {
+	if attempt >= c.MaxRetries {
+		return 0, false
 	}
 
-	return nil
+	var delay time.Duration
+	var apiErr *APIError
+	var urlErr *url.Error
+	switch {
+	case errors.As(err, &apiErr) && errors.Is(err, ErrRateLimited):
+		rl := apiErr.RateLimit
+		switch {
+		case rl.RetryAfter > 0:
+			delay = rl.RetryAfter
+		case rl.Exhausted() && !rl.Reset.IsZero():
+			delay = time.Until(rl.Reset) + time.Second
+		default:
+			delay = time.Minute
+		}
+
+	case errors.As(err, &apiErr) && apiErr.StatusCode >= 500,
+		errors.As(err, &urlErr) && isTransient(urlErr):
+		delay = retryBackoff << attempt
+
+	default:
+		return 0, false
+	}
+
+	if delay > c.MaxWait {
+		return 0, false
+	}
+	return delay, true
 }
 
-// makeGitHubRequest creates an HTTP request with proper headers
-func makeGitHubRequest(url string) (*http.Response, error) {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+// isTransient reports whether a network error may go away on its own: timeouts,
+// temporary DNS failures and dropped connections. Unknown hosts, TLS and
+// certificate errors and malformed URLs fail the same way every time
+func isTransient(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
 	}
 
-	// Add headers for GitHub API
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("User-Agent", "dalec-mapping-cli")
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
 
-	return client.Do(req)
+// errorMessage returns the "message" of a JSON error body, or the body itself
+func errorMessage(body []byte) string {
+	var data struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &data); err == nil && data.Message != "" {
+		return data.Message
+	}
+	return strings.TrimSpace(string(body))
 }
 
 // PrintRepoInfo displays repository information
@@ -187,6 +389,12 @@ func PrintRepoInfo(info *RepoInfo) {
 	}
 
 	fmt.Printf("  Default Branch: %s\n", info.DefaultBranch)
+	if info.Ref != "" && info.Ref != info.DefaultBranch {
+		fmt.Printf("  Ref: %s\n", info.Ref)
+	}
+	if info.Version != "" {
+		fmt.Printf("  Version: %s\n", info.Version)
+	}
 	fmt.Printf("  Latest Commit: %s\n", info.LatestCommit)
 	fmt.Println()
 }
@@ -0,0 +1,301 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAuthorizationHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"with token", "secret", "Bearer secret"},
+		{"without token", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			var sent bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("Authorization")
+				_, sent = r.Header["Authorization"]
+				fmt.Fprint(w, `{}`)
+			}))
+			defer srv.Close()
+
+			var v map[string]interface{}
+			if err := NewClient(srv.URL, tt.token).getJSON(srv.URL+"/repos/owner/repo", &v); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || sent != (tt.want != "") {
+				t.Errorf("Authorization = %q (sent %v), want %q", got, sent, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnterpriseURLs(t *testing.T) {
+	tests := []struct {
+		baseURL      string
+		wantEndpoint string
+		wantWeb      string
+	}{
+		{"", "https://api.github.com/repos/owner/repo", "https://github.com"},
+		{"https://api.github.com/", "https://api.github.com/repos/owner/repo", "https://github.com"},
+		{"https://ghe.example.com/api/v3", "https://ghe.example.com/api/v3/repos/owner/repo", "https://ghe.example.com"},
+		{"https://ghe.example.com/api/v3/", "https://ghe.example.com/api/v3/repos/owner/repo", "https://ghe.example.com"},
+		{"https://api.ghe.example.com", "https://api.ghe.example.com/repos/owner/repo", "https://ghe.example.com"},
+	}
+
+	for _, tt := range tests {
+		c := NewClient(tt.baseURL, "")
+		if got := c.endpoint("repos/%s/%s", "owner", "repo"); got != tt.wantEndpoint {
+			t.Errorf("%q: endpoint = %q, want %q", tt.baseURL, got, tt.wantEndpoint)
+		}
+		if got := c.WebURL(); got != tt.wantWeb {
+			t.Errorf("%q: WebURL = %q, want %q", tt.baseURL, got, tt.wantWeb)
+		}
+	}
+}
+
+func TestParseRepoPath(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		path    string
+		want    string // owner/repo, "" for an error
+	}{
+		{"", "owner/repo", "owner/repo"},
+		{"", "https://github.com/owner/repo", "owner/repo"},
+		{"", "github.com/owner/repo.git", "owner/repo"},
+		{"", "https://github.com/owner/repo/", "owner/repo"},
+		{"https://ghe.example.com/api/v3", "https://ghe.example.com/owner/repo", "owner/repo"},
+		{"https://ghe.example.com/api/v3", "ghe.example.com/owner/repo.git", "owner/repo"},
+		{"https://ghe.example.com/api/v3", "owner/repo", "owner/repo"},
+		{"", "repo", ""},
+	}
+
+	for _, tt := range tests {
+		owner, repo, err := NewClient(tt.baseURL, "").parseRepoPath(tt.path)
+		got := ""
+		if err == nil {
+			got = owner + "/" + repo
+		}
+		if got != tt.want {
+			t.Errorf("%q: parseRepoPath(%q) = %q (%v), want %q", tt.baseURL, tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestFetchRepoInfoEnterprise(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch": "main", "license": {"spdx_id": "MIT"}}`)
+	})
+	mux.HandleFunc("/api/v3/repos/owner/repo/commits/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha": "abc123"}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	info, err := NewClient(srv.URL+"/api/v3", "").FetchRepoInfo(srv.URL+"/owner/repo", FetchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.GitURL != srv.URL+"/owner/repo" || info.LatestCommit != "abc123" || info.License != "MIT" {
+		t.Errorf("FetchRepoInfo = %+v, want the Enterprise clone URL, commit abc123 and MIT", info)
+	}
+}
+
+// retryResponse is one canned response of newRetryServer
+type retryResponse struct {
+	status int
+	header map[string]string
+}
+
+// newRetryServer serves the responses in order and counts the requests;
+// sleep is replaced to record the waits instead of waiting
+func newRetryServer(t *testing.T, responses ...retryResponse) (*httptest.Server, *int, *[]time.Duration) {
+	t.Helper()
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := responses[min(requests, len(responses)-1)]
+		requests++
+		for k, v := range resp.header {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(resp.status)
+		if resp.status == http.StatusOK {
+			fmt.Fprint(w, `{}`)
+		} else {
+			fmt.Fprint(w, `{"message": "failed"}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	var waits []time.Duration
+	saved := sleep
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	t.Cleanup(func() { sleep = saved })
+
+	return srv, &requests, &waits
+}
+
+func TestRetry(t *testing.T) {
+	ok := retryResponse{status: http.StatusOK}
+	reset := strconv.FormatInt(time.Now().Add(30*time.Second).Unix(), 10)
+
+	tests := []struct {
+		name         string
+		responses    []retryResponse
+		maxRetries   int
+		maxWait      time.Duration
+		wantErr      error // nil for success; errAny for an error without a kind
+		wantRequests int
+		wantWaits    []time.Duration // Exact waits; nil to only count them
+		wantNumWaits int
+	}{
+		{
+			name:         "5xx backoff",
+			responses:    []retryResponse{{status: http.StatusBadGateway}, {status: http.StatusServiceUnavailable}, ok},
+			wantRequests: 3,
+			wantWaits:    []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:         "primary rate limit waits for the reset",
+			responses:    []retryResponse{{status: http.StatusForbidden, header: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": reset}}, ok},
+			wantRequests: 2,
+			wantNumWaits: 1,
+		},
+		{
+			name:         "permission error is not retried",
+			responses:    []retryResponse{{status: http.StatusForbidden, header: map[string]string{"X-RateLimit-Remaining": "4999"}}},
+			wantErr:      ErrUnauthorized,
+			wantRequests: 1,
+		},
+		{
+			name:         "429 with Retry-After",
+			responses:    []retryResponse{{status: http.StatusTooManyRequests, header: map[string]string{"Retry-After": "5"}}, ok},
+			wantRequests: 2,
+			wantWaits:    []time.Duration{5 * time.Second},
+		},
+		{
+			name:         "MaxRetries",
+			responses:    []retryResponse{{status: http.StatusInternalServerError}},
+			maxRetries:   2,
+			wantErr:      errAny,
+			wantRequests: 3,
+			wantWaits:    []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:         "MaxWait",
+			responses:    []retryResponse{{status: http.StatusTooManyRequests, header: map[string]string{"Retry-After": "120"}}},
+			maxWait:      time.Minute,
+			wantErr:      ErrRateLimited,
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests, waits := newRetryServer(t, tt.responses...)
+
+			c := NewClient(srv.URL, "")
+			if tt.maxRetries > 0 {
+				c.MaxRetries = tt.maxRetries
+			}
+			if tt.maxWait > 0 {
+				c.MaxWait = tt.maxWait
+			}
+
+			var v map[string]interface{}
+			err := c.getJSON(srv.URL+"/repos/owner/repo", &v)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("error = %v, want success", err)
+			case tt.wantErr == errAny && err == nil:
+				t.Errorf("error = nil, want the last response")
+			case tt.wantErr != nil && tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			if *requests != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", *requests, tt.wantRequests)
+			}
+			if tt.wantWaits != nil {
+				if !reflect.DeepEqual(*waits, tt.wantWaits) {
+					t.Errorf("waits = %v, want %v", *waits, tt.wantWaits)
+				}
+			} else if len(*waits) != tt.wantNumWaits {
+				t.Errorf("waits = %v, want %d", *waits, tt.wantNumWaits)
+			}
+		})
+	}
+}
+
+// errAny expects an error of any kind in TestRetry
+var errAny = errors.New("any error")
+
+func TestNetworkErrorRetry(t *testing.T) {
+	var waits []time.Duration
+	saved := sleep
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { sleep = saved }()
+
+	// The first connection is dropped without a response, the second one succeeds
+	requests := 0
+	dropping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer dropping.Close()
+
+	untrusted := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer untrusted.Close()
+
+	tests := []struct {
+		name      string
+		url       string
+		wantErr   bool
+		wantWaits int
+	}{
+		{"dropped connection", dropping.URL + "/repos/owner/repo", false, 1},
+		{"untrusted certificate", untrusted.URL + "/repos/owner/repo", true, 0},
+		{"unsupported scheme", "ftp://ghe.example.com/api/v3/repos/owner/repo", true, 0},
+	}
+
+	for _, tt := range tests {
+		waits = nil
+		var retried []error
+
+		c := NewClient("", "")
+		c.OnRetry = func(err error, wait time.Duration) { retried = append(retried, err) }
+
+		var v map[string]interface{}
+		err := c.getJSON(tt.url, &v)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if len(waits) != tt.wantWaits || len(retried) != tt.wantWaits {
+			t.Errorf("%s: waits = %v, OnRetry calls = %d, want %d retries", tt.name, waits, len(retried), tt.wantWaits)
+		}
+	}
+}
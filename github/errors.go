@@ -0,0 +1,118 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned by the client, matched with errors.Is
+var (
+	ErrNotFound     = errors.New("not found")           // 404: no such repository, ref or tag (or private without a token)
+	ErrUnauthorized = errors.New("unauthorized")        // 401, or 403 without a rate limit: bad token or missing permissions
+	ErrRateLimited  = errors.New("rate limit exceeded") // 403/429 from the primary or a secondary rate limit
+)
+
+// RateLimit is the rate limit state reported in the response headers
+type RateLimit struct {
+	Limit      int           // X-RateLimit-Limit, 0 if not reported
+	Remaining  int           // X-RateLimit-Remaining, -1 if not reported
+	Reset      time.Time     // X-RateLimit-Reset, zero if not reported
+	RetryAfter time.Duration // Retry-After (seconds or an HTTP date), set by secondary rate limits
+}
+
+// parseRateLimit reads the rate limit headers of a response
+func parseRateLimit(h http.Header) RateLimit {
+	rl := RateLimit{Remaining: -1}
+
+	if v, err := strconv.Atoi(h.Get("X-RateLimit-Limit")); err == nil {
+		rl.Limit = v
+	}
+	if v, err := strconv.Atoi(h.Get("X-RateLimit-Remaining")); err == nil {
+		rl.Remaining = v
+	}
+	if v, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		rl.Reset = time.Unix(v, 0)
+	}
+	if v := h.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			rl.RetryAfter = time.Duration(seconds) * time.Second
+		} else if date, err := http.ParseTime(v); err == nil {
+			// A date that already passed still asks for a (short) wait
+			rl.RetryAfter = max(time.Until(date), time.Second)
+		}
+	}
+
+	return rl
+}
+
+// Exhausted reports whether the primary rate limit is used up
+func (rl RateLimit) Exhausted() bool {
+	return rl.Remaining == 0
+}
+
+// APIError is a failed GitHub API request
+// errors.Is matches it against ErrNotFound, ErrUnauthorized and ErrRateLimited
+type APIError struct {
+	StatusCode int
+	Status     string
+	URL        string
+	Message    string // "message" of the JSON error body, or the body itself
+	RateLimit  RateLimit
+	kind       error
+}
+
+// Error formats the error like the previous "GitHub API error: 404 Not Found - ..." messages
+func (e *APIError) Error() string {
+	msg := "GitHub API error: " + e.Status
+	if e.Message != "" {
+		msg += " - " + e.Message
+	}
+	if errors.Is(e.kind, ErrRateLimited) && !e.RateLimit.Reset.IsZero() {
+		msg += fmt.Sprintf(" (resets at %s)", e.RateLimit.Reset.Format(time.Kitchen))
+	}
+	return msg
+}
+
+// Unwrap returns the error kind (ErrNotFound, ...), nil for other failures
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// newAPIError classifies a failed response
+func newAPIError(resp *http.Response, url, message string) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		URL:        url,
+		Message:    message,
+		RateLimit:  parseRateLimit(resp.Header),
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		e.kind = ErrNotFound
+	case http.StatusUnauthorized:
+		e.kind = ErrUnauthorized
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		// GitHub uses 403 both for rate limits and for missing permissions
+		if isRateLimit(resp.StatusCode, e.RateLimit, message) {
+			e.kind = ErrRateLimited
+		} else {
+			e.kind = ErrUnauthorized
+		}
+	}
+
+	return e
+}
+
+// isRateLimit reports whether a 403/429 response is a primary or secondary rate limit
+func isRateLimit(status int, rl RateLimit, message string) bool {
+	return status == http.StatusTooManyRequests ||
+		rl.Exhausted() ||
+		rl.RetryAfter > 0 ||
+		strings.Contains(strings.ToLower(message), "rate limit")
+}
@@ -0,0 +1,84 @@
+package github
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		check  func(RateLimit) bool
+	}{
+		{"none", nil, func(rl RateLimit) bool {
+			return rl.Limit == 0 && rl.Remaining == -1 && rl.Reset.IsZero() && rl.RetryAfter == 0
+		}},
+		{"primary", map[string]string{
+			"X-RateLimit-Limit":     "60",
+			"X-RateLimit-Remaining": "0",
+			"X-RateLimit-Reset":     strconv.FormatInt(reset.Unix(), 10),
+		}, func(rl RateLimit) bool {
+			return rl.Limit == 60 && rl.Exhausted() && rl.Reset.Equal(reset)
+		}},
+		{"retry after seconds", map[string]string{"Retry-After": "30"}, func(rl RateLimit) bool {
+			return rl.RetryAfter == 30*time.Second
+		}},
+		{"retry after date", map[string]string{"Retry-After": time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)}, func(rl RateLimit) bool {
+			return rl.RetryAfter > 28*time.Second && rl.RetryAfter <= 30*time.Second
+		}},
+		{"retry after past date", map[string]string{"Retry-After": time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)}, func(rl RateLimit) bool {
+			return rl.RetryAfter == time.Second
+		}},
+		{"retry after garbage", map[string]string{"Retry-After": "soon"}, func(rl RateLimit) bool {
+			return rl.RetryAfter == 0
+		}},
+	}
+
+	for _, tt := range tests {
+		h := http.Header{}
+		for k, v := range tt.header {
+			h.Set(k, v)
+		}
+		if rl := parseRateLimit(h); !tt.check(rl) {
+			t.Errorf("%s: parseRateLimit = %+v", tt.name, rl)
+		}
+	}
+}
+
+func TestAPIErrorKind(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		header  map[string]string
+		message string
+		want    error
+	}{
+		{"not found", http.StatusNotFound, nil, "Not Found", ErrNotFound},
+		{"bad credentials", http.StatusUnauthorized, nil, "Bad credentials", ErrUnauthorized},
+		{"primary rate limit", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0"}, "API rate limit exceeded", ErrRateLimited},
+		{"secondary rate limit", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "4000", "Retry-After": "60"}, "You have exceeded a secondary rate limit", ErrRateLimited},
+		{"missing permission", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "4000"}, "Resource not accessible by integration", ErrUnauthorized},
+		{"too many requests", http.StatusTooManyRequests, nil, "", ErrRateLimited},
+		{"server error", http.StatusBadGateway, nil, "", nil},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		for k, v := range tt.header {
+			rec.Header().Set(k, v)
+		}
+		rec.WriteHeader(tt.status)
+
+		err := newAPIError(rec.Result(), "https://api.github.com/repos/owner/repo", tt.message)
+		if got := errors.Unwrap(err); got != tt.want {
+			t.Errorf("%s: kind = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -14,6 +14,7 @@ func (info *RepoInfo) ToRepoMetadata() map[string]interface{} {
 		"Description": info.Description,
 		"License":     info.License,
 		"RepoName":    info.Repo,
+		"Version":     info.Version,
 	}
 }
 
@@ -0,0 +1,224 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// FetchOptions selects the commit that is packaged
+// Without Ref or LatestRelease the head of the default branch is used
+type FetchOptions struct {
+	Ref           string // Branch, tag or commit SHA
+	LatestRelease bool   // Newest GitHub release, or the newest semver tag if there are no releases
+}
+
+// resolveCommit sets LatestCommit (and Ref/Version for tags) according to opts
+func (c *Client) resolveCommit(info *RepoInfo, opts FetchOptions) error {
+	switch {
+	case opts.LatestRelease:
+		tag, err := c.latestReleaseTag(info)
+		if err != nil {
+			return err
+		}
+		return c.resolveRef(info, tag)
+
+	case opts.Ref != "":
+		return c.resolveRef(info, opts.Ref)
+
+	default:
+		info.Ref = info.DefaultBranch
+		return c.fetchLatestCommit(info)
+	}
+}
+
+// resolveRef resolves a tag, branch or commit SHA to a commit SHA
+// Tags are tried first, so a tag and a branch of the same name resolve to the tag
+func (c *Client) resolveRef(info *RepoInfo, ref string) error {
+	sha, err := c.resolveTag(info, ref)
+	if err == nil {
+		info.Ref = ref
+		info.LatestCommit = sha
+		info.Version = VersionFromTag(ref)
+		return nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	// Not a tag: the commits endpoint accepts branches and (short) SHAs
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	apiURL := c.endpoint("repos/%s/%s/commits/%s", info.Owner, info.Repo, escapeRef(ref))
+	if err := c.getJSON(apiURL, &commit); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("ref %q is not a tag, branch or commit of %s: %w", ref, info.FullName, ErrNotFound)
+		}
+		return fmt.Errorf("failed to resolve ref %q: %w", ref, err)
+	}
+
+	info.Ref = ref
+	info.LatestCommit = commit.SHA
+	return nil
+}
+
+// gitObject is the target of a git ref or annotated tag
+type gitObject struct {
+	Type string `json:"type"` // "commit" or "tag"
+	SHA  string `json:"sha"`
+}
+
+// resolveTag returns the commit a tag points to
+// Lightweight tags point at the commit, annotated tags at a tag object that is peeled
+func (c *Client) resolveTag(info *RepoInfo, tag string) (string, error) {
+	var ref struct {
+		Object gitObject `json:"object"`
+	}
+	apiURL := c.endpoint("repos/%s/%s/git/ref/tags/%s", info.Owner, info.Repo, escapeRef(tag))
+	if err := c.getJSON(apiURL, &ref); err != nil {
+		return "", err
+	}
+
+	object := ref.Object
+	// Tags of tags are allowed, so peel until a commit is reached
+	for depth := 0; object.Type == "tag"; depth++ {
+		if depth == 10 {
+			return "", fmt.Errorf("tag %q: too many nested tag objects", tag)
+		}
+
+		var annotated struct {
+			Object gitObject `json:"object"`
+		}
+		apiURL := c.endpoint("repos/%s/%s/git/tags/%s", info.Owner, info.Repo, object.SHA)
+		if err := c.getJSON(apiURL, &annotated); err != nil {
+			return "", fmt.Errorf("failed to resolve annotated tag %q: %w", tag, err)
+		}
+		object = annotated.Object
+	}
+
+	if object.Type != "commit" {
+		return "", fmt.Errorf("tag %q points to a %s, not a commit", tag, object.Type)
+	}
+	return object.SHA, nil
+}
+
+// maxTagPages bounds the tag listing (100 tags per page); repositories with
+// more tags than that need -ref
+const maxTagPages = 50
+
+// latestReleaseTag returns the tag of the latest GitHub release (drafts and
+// prereleases excluded), or the newest semver tag if the repository has no releases
+func (c *Client) latestReleaseTag(info *RepoInfo) (string, error) {
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	apiURL := c.endpoint("repos/%s/%s/releases/latest", info.Owner, info.Repo)
+	err := c.getJSON(apiURL, &release)
+	if err == nil && release.TagName != "" {
+		return release.TagName, nil
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", fmt.Errorf("failed to fetch latest release: %w", err)
+	}
+
+	names, err := c.listTags(info)
+	if err != nil {
+		return "", err
+	}
+	tag := NewestSemverTag(names)
+	if tag == "" {
+		return "", fmt.Errorf("%s has no releases and no semver release tags: %w", info.FullName, ErrNotFound)
+	}
+	return tag, nil
+}
+
+// listTags returns the names of all tags, following the pages of the Link header
+func (c *Client) listTags(info *RepoInfo) ([]string, error) {
+	var names []string
+	apiURL := c.endpoint("repos/%s/%s/tags?per_page=100", info.Owner, info.Repo)
+	for page := 0; apiURL != ""; page++ {
+		if page == maxTagPages {
+			return nil, fmt.Errorf("%s has more than %d tags, pass the tag with -ref", info.FullName, maxTagPages*100)
+		}
+
+		body, header, err := c.get(apiURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+		var tags []struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(body, &tags); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		for _, t := range tags {
+			names = append(names, t.Name)
+		}
+
+		apiURL = nextPage(header)
+	}
+	return names, nil
+}
+
+// NewestSemverTag returns the highest semver release tag, "" if there is none
+// Like the latest GitHub release, prereleases (v1.2.3-rc.1) are skipped; tags
+// without the leading "v" (1.2.3) count as well, other tags are ignored
+func NewestSemverTag(tags []string) string {
+	newest := ""
+	for _, tag := range tags {
+		v := semverOf(tag)
+		if v == "" || semver.Prerelease(v) != "" {
+			continue
+		}
+		if newest == "" || semver.Compare(v, semverOf(newest)) > 0 {
+			newest = tag
+		}
+	}
+	return newest
+}
+
+// VersionFromTag derives the package VERSION from a tag: "v1.2.3" → "1.2.3"
+// Prefixed tags ("release/v1.2.3") are supported; tags that are no version give ""
+// "-" is not allowed in RPM and Debian versions, so a prerelease becomes a "~"
+// suffix that sorts before the release ("v1.2.3-rc-1" → "1.2.3~rc.1") and build
+// metadata ("+build.5") is dropped
+func VersionFromTag(tag string) string {
+	v := semverOf(tag)
+	if v == "" {
+		return ""
+	}
+
+	version, _, _ := strings.Cut(strings.TrimPrefix(v, "v"), "+")
+	if release, pre, ok := strings.Cut(version, "-"); ok {
+		version = release + "~" + strings.ReplaceAll(pre, "-", ".")
+	}
+	return version
+}
+
+// semverOf returns the tag as a "v"-prefixed semantic version, "" if it is none
+func semverOf(tag string) string {
+	if i := strings.LastIndex(tag, "/"); i >= 0 {
+		tag = tag[i+1:]
+	}
+	if !strings.HasPrefix(tag, "v") {
+		tag = "v" + tag
+	}
+	if !semver.IsValid(tag) {
+		return ""
+	}
+	return tag
+}
+
+// escapeRef escapes a ref for an API path, keeping the slashes of "release/v1.2.3"
+func escapeRef(ref string) string {
+	segments := strings.Split(ref, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,187 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewestSemverTag(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want string
+	}{
+		{"highest release", []string{"v1.2.3", "v1.10.0", "v1.9.9"}, "v1.10.0"},
+		{"without v", []string{"1.2.3", "1.3.0"}, "1.3.0"},
+		{"prefixed", []string{"release/v1.2.3", "release/v1.2.4"}, "release/v1.2.4"},
+		{"release beats newer prerelease", []string{"v1.2.3", "v2.0.0-rc.1"}, "v1.2.3"},
+		{"prerelease only", []string{"v2.0.0-rc.1", "v2.0.0-beta.2"}, ""},
+		{"no versions", []string{"latest", "nightly"}, ""},
+		{"none", nil, ""},
+	}
+
+	for _, tt := range tests {
+		if got := NewestSemverTag(tt.tags); got != tt.want {
+			t.Errorf("%s: NewestSemverTag(%q) = %q, want %q", tt.name, tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestVersionFromTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"v1.2.3", "1.2.3"},
+		{"1.2.3", "1.2.3"},
+		{"v1.2", "1.2"},
+		{"release/v1.2.3", "1.2.3"},
+		{"v1.2.3-rc.1", "1.2.3~rc.1"},
+		{"v1.2.3-rc-1", "1.2.3~rc.1"},
+		{"v1.2.3+build.5", "1.2.3"},
+		{"v1.2.3-beta.2+build.5", "1.2.3~beta.2"},
+		{"main", ""},
+		{"release/latest", ""},
+	}
+
+	for _, tt := range tests {
+		if got := VersionFromTag(tt.tag); got != tt.want {
+			t.Errorf("VersionFromTag(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestSemverOf(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"v1.2.3", "v1.2.3"},
+		{"1.2.3", "v1.2.3"},
+		{"release/v1.2.3", "v1.2.3"},
+		{"tools/cli/1.0.0-rc.1", "v1.0.0-rc.1"},
+		{"vv1.2.3", ""},
+		{"1.2.3.4", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := semverOf(tt.tag); got != tt.want {
+			t.Errorf("semverOf(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"v1.2.3", "v1.2.3"},
+		{"release/v1.2.3", "release/v1.2.3"},
+		{"feature/a b", "feature/a%20b"},
+		{"fix#1", "fix%231"},
+		{"a?b", "a%3Fb"},
+	}
+
+	for _, tt := range tests {
+		if got := escapeRef(tt.ref); got != tt.want {
+			t.Errorf("escapeRef(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestResolveNestedAnnotatedTag(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/git/ref/tags/release/v1.2.3", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"object": {"type": "tag", "sha": "outer"}}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/git/tags/outer", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"object": {"type": "tag", "sha": "inner"}}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/git/tags/inner", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"object": {"type": "commit", "sha": "abc123"}}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	info := &RepoInfo{Owner: "owner", Repo: "repo", FullName: "owner/repo"}
+	if err := NewClient(srv.URL, "").resolveRef(info, "release/v1.2.3"); err != nil {
+		t.Fatal(err)
+	}
+	if info.LatestCommit != "abc123" || info.Version != "1.2.3" || info.Ref != "release/v1.2.3" {
+		t.Errorf("resolved %+v, want commit abc123, version 1.2.3", info)
+	}
+}
+
+func TestLatestReleaseTagFollowsPages(t *testing.T) {
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+	})
+	mux.HandleFunc("/repos/owner/repo/tags", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/owner/repo/tags?per_page=100&page=2>; rel="next", <%s/repos/owner/repo/tags?per_page=100&page=2>; rel="last"`, srv.URL, srv.URL))
+			fmt.Fprint(w, `[{"name": "v1.0.0"}, {"name": "v2.0.0-rc.1"}]`)
+		case "2":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/owner/repo/tags?per_page=100&page=1>; rel="first"`, srv.URL))
+			fmt.Fprint(w, `[{"name": "v1.1.0"}, {"name": "nightly"}]`)
+		default:
+			t.Errorf("unexpected page %s", r.URL.Query().Get("page"))
+		}
+	})
+	srv = httptest.NewServer(mux)
+	defer srv.Close()
+
+	info := &RepoInfo{Owner: "owner", Repo: "repo", FullName: "owner/repo"}
+	tag, err := NewClient(srv.URL, "").latestReleaseTag(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag != "v1.1.0" {
+		t.Errorf("latestReleaseTag = %q, want v1.1.0 from the second page", tag)
+	}
+}
+
+func TestLatestReleaseTagPrereleaseOnly(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+	})
+	mux.HandleFunc("/repos/owner/repo/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name": "v2.0.0-rc.1"}]`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	info := &RepoInfo{Owner: "owner", Repo: "repo", FullName: "owner/repo"}
+	if _, err := NewClient(srv.URL, "").latestReleaseTag(info); !errors.Is(err, ErrNotFound) {
+		t.Errorf("latestReleaseTag error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{`<https://api.github.com/repositories/1/tags?page=2>; rel="next", <https://api.github.com/repositories/1/tags?page=5>; rel="last"`, "https://api.github.com/repositories/1/tags?page=2"},
+		{`<https://api.github.com/repositories/1/tags?page=1>; rel="prev", <https://api.github.com/repositories/1/tags?page=1>; rel="first"`, ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.link != "" {
+			header.Set("Link", tt.link)
+		}
+		if got := nextPage(header); got != tt.want {
+			t.Errorf("nextPage(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
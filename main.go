@@ -1,21 +1,47 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
+	"dalec-mapping/cli"
+	"dalec-mapping/diagnostics"
 	"dalec-mapping/github"
+	"dalec-mapping/mapping"
 	"dalec-mapping/parser"
 	"dalec-mapping/transformer"
 )
 
+// version is recorded in the header of generated specs
+// Set at build time with -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// Exit codes; 2 is used by the flag package for usage errors
+const (
+	exitError        = 1 // Any other failure
+	exitNotFound     = 3 // Repository, ref or release not found
+	exitUnauthorized = 4 // Token missing, invalid or lacking permissions
+	exitRateLimited  = 5 // GitHub API rate limit exceeded
+)
+
 type cliOptions struct {
 	repoPath       *string
 	dockerfilePath *string
 	specFilePath   *string
 	outputPath     *string
 	verbose        *bool
+	buildArgs      cli.KeyValueFlag
+	target         *string
+	strict         *bool
+	packageMap     *string
+	contextDir     *string
+	ref            *string
+	latestRelease  *bool
+	apiURL         *string
+	tokenFile      *string
 }
 
 func main() {
@@ -26,20 +52,29 @@ func main() {
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 
 	// Fetch GitHub repository info
-	repoInfo, err := fetchGitHubRepoInfo(*cliOptions.repoPath)
+	client, err := newGitHubClient(*cliOptions.apiURL, *cliOptions.tokenFile)
 	if err != nil {
-		fmt.Printf("❌ Error fetching repository info: %v\n", err)
+		fmt.Printf("❌ Error configuring GitHub client: %v\n", err)
 		os.Exit(1)
 	}
+	fetchOpts := github.FetchOptions{Ref: *cliOptions.ref, LatestRelease: *cliOptions.latestRelease}
+	repoInfo, err := fetchGitHubRepoInfo(client, *cliOptions.repoPath, fetchOpts)
+	if err != nil {
+		os.Exit(githubExitCode(err))
+	}
 
 	// Parse Dockerfile if path provided
-	dockerfileInfo, err := fetchDockerfileInfo(*cliOptions.dockerfilePath, *cliOptions.verbose)
+	parseOpts := parser.ParseOptions{
+		BuildArgs: cliOptions.buildArgs,
+		Target:    *cliOptions.target,
+	}
+	dockerfileInfo, err := fetchDockerfileInfo(*cliOptions.dockerfilePath, parseOpts, *cliOptions.verbose)
 	if err != nil {
 		fmt.Printf("❌ Error parsing Dockerfile: %v\n", err)
 	}
 
 	// Read previous YAML file if exists
-	previousYAMLInfo, err := fetchPreviousYAMLInfo(*cliOptions.specFilePath)
+	previousYAMLInfo, err := fetchPreviousYAMLInfo(*cliOptions.specFilePath, *cliOptions.outputPath)
 	if err != nil {
 		fmt.Printf("❌ Error reading previous YAML info: %v\n", err)
 	}
@@ -57,10 +92,38 @@ func main() {
 			Description: repoInfo.Description,
 			License:     repoInfo.License,
 			RepoName:    repoInfo.Repo,
+			Version:     repoInfo.Version,
+		}
+	}
+
+	transformOpts := transformer.Options{PackageMap: mapping.Builtin(), ToolVersion: version}
+	if *cliOptions.contextDir != "" {
+		transformOpts.Repo = transformer.DirFiles(*cliOptions.contextDir)
+	}
+	if *cliOptions.packageMap != "" {
+		transformOpts.PackageMap, err = mapping.LoadFile(*cliOptions.packageMap)
+		if err != nil {
+			fmt.Printf("❌ Error loading package map: %v\n", err)
+			os.Exit(1)
 		}
 	}
 
-	dalecSpec := transformer.TransformToDalec(repoMeta, previousYAMLInfo, dockerfileInfo)
+	generated, diags := transformer.TransformToDalec(repoMeta, previousYAMLInfo, dockerfileInfo, transformOpts)
+
+	// Keep hand edits from the previous spec
+	dalecSpec := transformer.MergePrevious(previousYAMLInfo, generated, diags)
+	diagnostics.PrintDiagnostics(diags, *cliOptions.verbose)
+
+	// The reasoning behind VERSION and REVISION is in the info diagnostics (-v)
+	if args, ok := dalecSpec["args"].(map[string]interface{}); ok {
+		fmt.Printf("🏷️  VERSION %v, REVISION %v\n\n", args["VERSION"], args["REVISION"])
+	}
+
+	// In strict mode any warning fails the run, e.g. in CI; the output is left untouched
+	if problems := diags.Count(diagnostics.Warning) + diags.Count(diagnostics.Error); *cliOptions.strict && problems > 0 {
+		fmt.Printf("❌ Strict mode: %d warning(s) or error(s) reported, %s not written\n", problems, *cliOptions.outputPath)
+		os.Exit(1)
+	}
 
 	// Write to output file
 	yamlContent, err := transformer.WriteYAML(dalecSpec)
@@ -75,6 +138,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The fresh generation is the baseline of the next merge
+	if err := transformer.WriteBaseline(*cliOptions.outputPath, generated); err != nil {
+		fmt.Printf("❌ Error writing baseline for %s: %v\n", *cliOptions.outputPath, err)
+		os.Exit(1)
+	}
+
 	fmt.Printf("✅ Successfully generated %s\n\n", *cliOptions.outputPath)
 }
 
@@ -85,6 +154,16 @@ func defineFlags() cliOptions {
 	specFilePath := flag.String("spec", "", "Path to previous Dalec spec YAML file")
 	outputPath := flag.String("output", "output.yml", "Output YAML file path")
 	verbose := flag.Bool("v", false, "Verbose output")
+	buildArgs := cli.KeyValueFlag{}
+	flag.Var(buildArgs, "build-arg", "Set a Dockerfile ARG value (KEY=VALUE, repeatable)")
+	target := flag.String("target", "", "Dockerfile stage to build, like docker build --target (default: last stage)")
+	packageMap := flag.String("package-map", "", "YAML file extending the built-in package name mapping")
+	ref := flag.String("ref", "", "Branch, tag or commit SHA to package (default: head of the default branch)")
+	latestRelease := flag.Bool("latest-release", false, "Package the latest GitHub release (or newest semver tag); sets VERSION from the tag")
+	apiURL := flag.String("api-url", os.Getenv("GITHUB_API_URL"), "GitHub API URL, e.g. https://ghe.example.com/api/v3 for GitHub Enterprise (default: $GITHUB_API_URL or https://api.github.com)")
+	tokenFile := flag.String("token-file", "", "File containing a GitHub token (default: $GITHUB_TOKEN or $GH_TOKEN)")
+	contextDir := flag.String("context", "", "Repository checkout (build context) used to detect go.mod, Cargo.toml, package.json, ...")
+	strict := flag.Bool("strict", false, "Exit with an error, without writing the output, if any warnings are reported (parser, lint or conversion)")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
@@ -94,6 +173,8 @@ func defineFlags() cliOptions {
 		fmt.Fprintf(os.Stderr, "\nExample:\n")
 		fmt.Fprintf(os.Stderr, "  %s -repo Ryuki-997/HelloWorld\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -repo https://github.com/owner/repo -dockerfile ./Dockerfile -output spec.yml\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -repo owner/repo -dockerfile ./Dockerfile -build-arg GO_VERSION=1.22\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -repo owner/repo -dockerfile ./Dockerfile -latest-release\n", os.Args[0])
 	}
 
 	flag.Parse()
@@ -105,21 +186,56 @@ func defineFlags() cliOptions {
 		os.Exit(1)
 	}
 
+	if *ref != "" && *latestRelease {
+		fmt.Fprintf(os.Stderr, "Error: -ref and -latest-release cannot be combined\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	return cliOptions{
 		repoPath:       repoPath,
 		dockerfilePath: dockerfilePath,
 		specFilePath:   specFilePath,
 		outputPath:     outputPath,
 		verbose:        verbose,
+		buildArgs:      buildArgs,
+		target:         target,
+		strict:         strict,
+		packageMap:     packageMap,
+		contextDir:     contextDir,
+		ref:            ref,
+		latestRelease:  latestRelease,
+		apiURL:         apiURL,
+		tokenFile:      tokenFile,
 	}
 }
 
-func fetchGitHubRepoInfo(repoPath string) (*github.RepoInfo, error) {
+// newGitHubClient creates the API client; the token comes from tokenFile or the environment
+func newGitHubClient(apiURL, tokenFile string) (*github.Client, error) {
+	token := github.TokenFromEnv()
+	if tokenFile != "" {
+		var err error
+		if token, err = github.ReadTokenFile(tokenFile); err != nil {
+			return nil, err
+		}
+	}
+
+	client := github.NewClient(apiURL, token)
+	client.OnRetry = func(err error, wait time.Duration) {
+		fmt.Printf("⏳ %v, retrying in %s\n", err, wait.Round(time.Second))
+	}
+	return client, nil
+}
+
+func fetchGitHubRepoInfo(client *github.Client, repoPath string, opts github.FetchOptions) (*github.RepoInfo, error) {
 	// Fetch GitHub repository information
 	fmt.Println("=== FETCHING GITHUB METADATA ===")
-	repoInfo, err := github.FetchRepoInfo(repoPath)
+	repoInfo, err := client.FetchRepoInfo(repoPath, opts)
 	if err != nil {
 		fmt.Printf("❌ Error fetching repository info: %v\n", err)
+		if hint := githubErrorHint(err, client.Token != ""); hint != "" {
+			fmt.Printf("💡 %s\n", hint)
+		}
 		return nil, err
 	} else {
 		github.PrintRepoInfo(repoInfo)
@@ -128,7 +244,50 @@ func fetchGitHubRepoInfo(repoPath string) (*github.RepoInfo, error) {
 	return repoInfo, nil
 }
 
-func fetchDockerfileInfo(dockerfilePath string, verbose bool) (*parser.DockerfileInfo, error) {
+// githubErrorHint suggests how to fix a GitHub API error, "" if there is nothing to suggest
+func githubErrorHint(err error, hasToken bool) string {
+	switch {
+	case errors.Is(err, github.ErrRateLimited):
+		hint := "GitHub API rate limit exceeded"
+		var apiErr *github.APIError
+		if errors.As(err, &apiErr) && !apiErr.RateLimit.Reset.IsZero() {
+			reset := apiErr.RateLimit.Reset
+			hint += fmt.Sprintf(", it resets at %s (in %s)", reset.Format(time.Kitchen), time.Until(reset).Round(time.Minute))
+		}
+		if !hasToken {
+			hint += "; set GITHUB_TOKEN or use -token-file for a higher limit"
+		}
+		return hint
+
+	case errors.Is(err, github.ErrUnauthorized):
+		if !hasToken {
+			return "the request needs authentication; set GITHUB_TOKEN or use -token-file"
+		}
+		return "the token was rejected or lacks access to the repository; check GITHUB_TOKEN, GH_TOKEN or -token-file"
+
+	case errors.Is(err, github.ErrNotFound):
+		if !hasToken {
+			return "check -repo and -ref; private repositories need GITHUB_TOKEN or -token-file"
+		}
+		return "check -repo and -ref, and that the token can read the repository"
+	}
+	return ""
+}
+
+// githubExitCode maps a GitHub API error to the exit code
+func githubExitCode(err error) int {
+	switch {
+	case errors.Is(err, github.ErrRateLimited):
+		return exitRateLimited
+	case errors.Is(err, github.ErrUnauthorized):
+		return exitUnauthorized
+	case errors.Is(err, github.ErrNotFound):
+		return exitNotFound
+	}
+	return exitError
+}
+
+func fetchDockerfileInfo(dockerfilePath string, opts parser.ParseOptions, verbose bool) (*parser.DockerfileInfo, error) {
 	fmt.Println("=== PARSING DOCKERFILE ===")
 
 	var dockerfileInfo *parser.DockerfileInfo
@@ -138,7 +297,7 @@ func fetchDockerfileInfo(dockerfilePath string, verbose bool) (*parser.Dockerfil
 		return nil, nil
 	}
 
-	dockerfileInfo, err := parser.ParseDockerfile(dockerfilePath)
+	dockerfileInfo, err := parser.ParseDockerfile(dockerfilePath, opts)
 	if err != nil {
 		fmt.Printf("❌ Error parsing Dockerfile: %v\n", err)
 		os.Exit(1)
@@ -153,7 +312,8 @@ func fetchDockerfileInfo(dockerfilePath string, verbose bool) (*parser.Dockerfil
 	return dockerfileInfo, nil
 }
 
-func fetchPreviousYAMLInfo(filepath string) (transformer.PreviousDalecSpec, error) {
+// fetchPreviousYAMLInfo reads the previous spec and the baseline next to outputPath, where WriteBaseline put it
+func fetchPreviousYAMLInfo(filepath, outputPath string) (transformer.PreviousDalecSpec, error) {
 	fmt.Println("=== READING PREVIOUS YAML FILE ===")
 
 	if filepath == "" {
@@ -171,6 +331,11 @@ func fetchPreviousYAMLInfo(filepath string) (transformer.PreviousDalecSpec, erro
 		return transformer.PreviousDalecSpec{}, err
 	}
 
+	if err := yamlInfo.ReadBaseline(outputPath); err != nil {
+		fmt.Printf("❌ Error reading baseline of %s: %v\n", outputPath, err)
+		return yamlInfo, err
+	}
+
 	fmt.Println("✅ Successfully read previous YAML file.")
 	return yamlInfo, nil
 }
@@ -0,0 +1,59 @@
+package mapping
+
+// azlinux3 maps Debian/Ubuntu and Alpine package names to Azure Linux 3 packages
+// Identical names are listed too, so they are known rather than reported as unmapped
+var azlinux3 = map[string][]string{
+	// Toolchains and build tools
+	"build-essential": {"gcc", "make", "glibc-devel", "binutils"},
+	"build-base":      {"gcc", "make", "glibc-devel", "binutils"}, // Alpine
+	"gcc":             {"gcc"},
+	"g++":             {"gcc-c++"},
+	"make":            {"make"},
+	"cmake":           {"cmake"},
+	"autoconf":        {"autoconf"},
+	"automake":        {"automake"},
+	"libtool":         {"libtool"},
+	"pkg-config":      {"pkgconf"},
+	"pkgconf":         {"pkgconf"},
+	"git":             {"git"},
+	"golang":          {"golang"},
+	"golang-go":       {"golang"},
+	"go":              {"golang"}, // Alpine
+
+	// Libraries (Debian -dev, Alpine -dev)
+	"libc6-dev":            {"glibc-devel"},
+	"musl-dev":             {"glibc-devel"},
+	"libssl-dev":           {"openssl-devel"},
+	"openssl-dev":          {"openssl-devel"},
+	"zlib1g-dev":           {"zlib-devel"},
+	"zlib-dev":             {"zlib-devel"},
+	"libffi-dev":           {"libffi-devel"},
+	"libsqlite3-dev":       {"sqlite-devel"},
+	"libcurl4-openssl-dev": {"curl-devel"},
+	"curl-dev":             {"curl-devel"},
+	"libseccomp-dev":       {"libseccomp-devel"},
+	"libgpgme-dev":         {"gpgme-devel"},
+	"libdevmapper-dev":     {"device-mapper-devel"},
+	"python3-dev":          {"python3-devel"},
+
+	// Runtime packages
+	"ca-certificates": {"ca-certificates"},
+	"tzdata":          {"tzdata"},
+	"openssl":         {"openssl"},
+	"curl":            {"curl"},
+	"wget":            {"wget"},
+	"bash":            {"bash"},
+	"tar":             {"tar"},
+	"gzip":            {"gzip"},
+	"unzip":           {"unzip"},
+	"xz-utils":        {"xz"},
+	"xz":              {"xz"},
+	"gnupg":           {"gnupg2"},
+	"procps":          {"procps-ng"},
+	"iproute2":        {"iproute"},
+	"iptables":        {"iptables"},
+	"python3":         {"python3"},
+	"python3-pip":     {"python3-pip"},
+	"py3-pip":         {"python3-pip"}, // Alpine
+	"netbase":         {},              // /etc/services and friends are part of the base image
+}
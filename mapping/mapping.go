@@ -0,0 +1,111 @@
+package mapping
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Package Mapping:
+================
+
+Dockerfiles usually install packages from Debian/Ubuntu (apt-get) or Alpine
+(apk), while Dalec targets build on other distros. A Table translates a
+package name into the names each Dalec target uses.
+
+Mapping file format (extends or overrides the built-in table):
+
+  build-essential:
+    azlinux3: [gcc, make, glibc-devel, binutils]
+  libssl-dev:
+    azlinux3: [openssl-devel]
+  netbase:
+    azlinux3: []        # not needed on this target
+*/
+
+// Table maps source package names to per-target package names
+type Table struct {
+	entries map[string]map[string][]string // package → target → names
+}
+
+// NewTable creates an empty mapping table
+func NewTable() *Table {
+	return &Table{entries: make(map[string]map[string][]string)}
+}
+
+// Builtin returns a table with the built-in Debian/Alpine to Azure Linux mappings
+func Builtin() *Table {
+	t := NewTable()
+	for pkg, names := range azlinux3 {
+		t.Add(pkg, "azlinux3", names...)
+	}
+	return t
+}
+
+// LoadFile returns the built-in table extended with the mappings in path
+func LoadFile(path string) (*Table, error) {
+	t := Builtin()
+	if err := t.Load(path); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Load merges a YAML mapping file into the table
+// Entries in the file replace the built-in names for the same package and target
+func (t *Table) Load(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read package map: %w", err)
+	}
+
+	var entries map[string]map[string][]string
+	if err := yaml.Unmarshal(content, &entries); err != nil {
+		return fmt.Errorf("failed to parse package map %s: %w", path, err)
+	}
+
+	for pkg, targets := range entries {
+		for target, names := range targets {
+			t.Add(pkg, target, names...)
+		}
+	}
+	return nil
+}
+
+// Add maps pkg to names on target; no names means the package is not needed there
+func (t *Table) Add(pkg, target string, names ...string) {
+	if t.entries[pkg] == nil {
+		t.entries[pkg] = make(map[string][]string)
+	}
+	t.entries[pkg][target] = append([]string{}, names...)
+}
+
+// Lookup returns the target-specific names for pkg, keyed by target
+// ok is false if the table has no mapping for pkg
+func (t *Table) Lookup(pkg string) (map[string][]string, bool) {
+	if t == nil {
+		return nil, false
+	}
+	targets, ok := t.entries[pkg]
+	return targets, ok
+}
+
+// Targets returns the Dalec targets the table has mappings for, sorted
+func (t *Table) Targets() []string {
+	seen := make(map[string]bool)
+	for _, targets := range t.entries {
+		for target := range targets {
+			seen[target] = true
+		}
+	}
+
+	var result []string
+	for target := range seen {
+		result = append(result, target)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,83 @@
+package mapping
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packages.yml")
+	content := `libssl-dev:
+  azlinux3: [openssl-devel, openssl-libs]
+libfoo-dev:
+  azlinux3: [foo-devel]
+  mariner2: [foo-devel]
+netbase:
+  azlinux3: []
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pkg    string
+		want   map[string][]string
+		wantOK bool
+	}{
+		{"libssl-dev", map[string][]string{"azlinux3": {"openssl-devel", "openssl-libs"}}, true}, // replaces the built-in names
+		{"libfoo-dev", map[string][]string{"azlinux3": {"foo-devel"}, "mariner2": {"foo-devel"}}, true},
+		{"netbase", map[string][]string{"azlinux3": {}}, true}, // not needed on the target
+		{"build-essential", Builtin().entries["build-essential"], true},
+		{"no-such-package", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := table.Lookup(tt.pkg)
+		if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lookup(%s) = %v, %v; want %v, %v", tt.pkg, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	if got := table.Targets(); !reflect.DeepEqual(got, []string{"azlinux3", "mariner2"}) {
+		t.Errorf("Targets = %v, want [azlinux3 mariner2]", got)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.yml")
+	if err := os.WriteFile(invalid, []byte("libfoo-dev: [foo-devel]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{filepath.Join(dir, "missing.yml"), invalid} {
+		if _, err := LoadFile(path); err == nil {
+			t.Errorf("LoadFile(%s) succeeded, want an error", filepath.Base(path))
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	table := NewTable()
+	names := []string{"foo-devel"}
+	table.Add("libfoo-dev", "azlinux3", names...)
+	names[0] = "changed"
+	table.Add("libfoo-dev", "mariner2")
+
+	got, ok := table.Lookup("libfoo-dev")
+	want := map[string][]string{"azlinux3": {"foo-devel"}, "mariner2": {}}
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("Lookup = %v, %v; want %v", got, ok, want)
+	}
+
+	var none *Table
+	if _, ok := none.Lookup("libfoo-dev"); ok {
+		t.Error("Lookup on a nil table found a mapping")
+	}
+}
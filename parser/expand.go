@@ -0,0 +1,312 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Variable Substitution:
+======================
+
+Docker expands $VAR and ${VAR} in most instructions before running them.
+We mirror the rules Docker uses so the transformer sees the same values
+the real build would:
+
+1. ARGs declared before the first FROM are global and only visible in FROM
+2. A stage sees a global ARG only after re-declaring it (ARG NAME)
+3. ENV shadows an ARG with the same name
+4. ENV is inherited by stages built FROM another stage, ARGs are not
+5. --build-arg overrides the default of a declared ARG
+
+Supported forms: $VAR, ${VAR}, ${VAR:-default}, ${VAR-default},
+${VAR:+alt}, ${VAR+alt}, ${VAR:?msg} and ${VAR?msg}.
+
+Variables the Dockerfile never declares (e.g. PATH from the base image)
+are left as written, since we cannot know their values. ${VAR:?msg} on a
+declared variable that is empty fails the real build; it is recorded on the
+scope and reported as a "required-variable" warning.
+*/
+
+// Word holds a Dockerfile value as written and after ARG/ENV substitution
+type Word struct {
+	Raw      string // Value as written in the Dockerfile
+	Expanded string // Value after ARG/ENV substitution
+}
+
+// String returns the expanded form
+func (w Word) String() string {
+	return w.Expanded
+}
+
+// References returns the variable names referenced by the raw value
+func (w Word) References() []string {
+	var refs []string
+	seen := make(map[string]bool)
+	lex := &lexer{
+		raw: true,
+		lookup: func(name string) (string, bool) {
+			if !seen[name] {
+				seen[name] = true
+				refs = append(refs, name)
+			}
+			return "", false
+		},
+	}
+	lex.process(w.Raw)
+	return refs
+}
+
+// predefinedArgs are available in FROM lines without being declared
+var predefinedArgs = []string{
+	"TARGETPLATFORM", "TARGETOS", "TARGETARCH", "TARGETVARIANT",
+	"BUILDPLATFORM", "BUILDOS", "BUILDARCH", "BUILDVARIANT",
+}
+
+// scope tracks the ARG and ENV values visible at a point in the Dockerfile
+type scope struct {
+	args map[string]string
+	env  map[string]string
+	errs []error // ${VAR:?msg} failures since the last takeErrors
+}
+
+func newScope() *scope {
+	return &scope{
+		args: make(map[string]string),
+		env:  make(map[string]string),
+	}
+}
+
+// lookup resolves a variable the way Docker does: ENV shadows ARG
+func (s *scope) lookup(name string) (string, bool) {
+	if v, ok := s.env[name]; ok {
+		return v, true
+	}
+	v, ok := s.args[name]
+	return v, ok
+}
+
+// expand processes a value used by a Dockerfile instruction (quotes are removed)
+func (s *scope) expand(value string) Word {
+	lex := &lexer{lookup: s.lookup, errs: &s.errs}
+	return Word{Raw: value, Expanded: lex.process(value)}
+}
+
+// expandShell substitutes known variables in a shell command, leaving quotes
+// and escapes for the shell to handle at runtime
+func (s *scope) expandShell(value string) Word {
+	lex := &lexer{lookup: s.lookup, raw: true, errs: &s.errs}
+	return Word{Raw: value, Expanded: lex.process(value)}
+}
+
+// declareArg resolves the value of an ARG declaration and records it in the scope
+// A --build-arg always wins; a stage ARG without default takes the global value
+func (s *scope) declareArg(key, value string, hasDefault bool, global *scope, buildArgs map[string]string) string {
+	resolved := s.expand(value).Expanded
+	if !hasDefault && global != nil {
+		if v, ok := global.args[key]; ok {
+			resolved = v
+		}
+	}
+	if v, ok := buildArgs[key]; ok {
+		resolved = v
+	}
+
+	s.args[key] = resolved
+	return resolved
+}
+
+// takeErrors returns and clears the substitution errors recorded by expand
+func (s *scope) takeErrors() []error {
+	if s == nil {
+		return nil
+	}
+	errs := s.errs
+	s.errs = nil
+	return errs
+}
+
+// lexer is a small shell-word processor modeled after buildkit's shell.Lex
+type lexer struct {
+	lookup func(name string) (string, bool)
+	raw    bool     // keep quotes and escapes as written
+	errs   *[]error // receives ${VAR:?msg} failures, nil to ignore them
+}
+
+func (l *lexer) process(word string) string {
+	var out strings.Builder
+	runes := []rune(word)
+
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch ch {
+		case '\\':
+			if i+1 < len(runes) {
+				if l.raw {
+					out.WriteRune(ch)
+				}
+				i++
+				out.WriteRune(runes[i])
+			} else {
+				out.WriteRune(ch)
+			}
+
+		case '\'':
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				end = len(runes)
+			}
+			if l.raw {
+				out.WriteString(string(runes[i:min(end+1, len(runes))]))
+			} else {
+				out.WriteString(string(runes[i+1 : end]))
+			}
+			i = end
+
+		case '"':
+			if l.raw {
+				out.WriteRune(ch)
+			}
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				switch {
+				case runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("$\"\\", runes[i+1]):
+					if l.raw {
+						out.WriteRune(runes[i])
+					}
+					i++
+					out.WriteRune(runes[i])
+				case runes[i] == '$':
+					n := l.variable(runes[i:], &out)
+					i += n - 1
+				default:
+					out.WriteRune(runes[i])
+				}
+			}
+			if l.raw && i < len(runes) {
+				out.WriteRune('"')
+			}
+
+		case '$':
+			n := l.variable(runes[i:], &out)
+			i += n - 1
+
+		default:
+			out.WriteRune(ch)
+		}
+	}
+
+	return out.String()
+}
+
+// variable expands the variable at the start of runes and returns how many
+// runes it consumed
+func (l *lexer) variable(runes []rune, out *strings.Builder) int {
+	if len(runes) < 2 {
+		out.WriteRune('$')
+		return 1
+	}
+
+	// $NAME
+	if isNameStart(runes[1]) {
+		end := 1
+		for end < len(runes) && isNameChar(runes[end]) {
+			end++
+		}
+		name := string(runes[1:end])
+		l.substitute(name, string(runes[:end]), out)
+		return end
+	}
+
+	if runes[1] != '{' {
+		out.WriteRune('$')
+		return 1
+	}
+
+	// ${NAME...}
+	end := indexRune(runes, 2, '}')
+	if end < 0 {
+		out.WriteString(string(runes))
+		return len(runes)
+	}
+	original := string(runes[:end+1])
+	body := string(runes[2:end])
+
+	nameEnd := 0
+	for nameEnd < len(body) && isNameChar(rune(body[nameEnd])) {
+		nameEnd++
+	}
+	name, modifier := body[:nameEnd], body[nameEnd:]
+
+	if modifier == "" {
+		l.substitute(name, original, out)
+		return end + 1
+	}
+
+	value, set := l.lookup(name)
+	if !set {
+		out.WriteString(original)
+		return end + 1
+	}
+
+	colon := strings.HasPrefix(modifier, ":")
+	op := strings.TrimPrefix(modifier, ":")
+	if op == "" {
+		out.WriteString(original)
+		return end + 1
+	}
+	word := (&lexer{lookup: l.lookup, raw: l.raw, errs: l.errs}).process(op[1:])
+	present := !colon || value != ""
+
+	switch op[0] {
+	case '-':
+		if present {
+			out.WriteString(value)
+		} else {
+			out.WriteString(word)
+		}
+	case '+':
+		if present {
+			out.WriteString(word)
+		}
+	case '?':
+		// Like buildkit, ${VAR:?msg} also fails for a set but empty variable
+		if !present && l.errs != nil {
+			if word == "" {
+				word = "must not be empty"
+			}
+			*l.errs = append(*l.errs, fmt.Errorf("%s: %s", name, word))
+		}
+		out.WriteString(value)
+	default:
+		out.WriteString(original)
+	}
+
+	return end + 1
+}
+
+// substitute writes the value of name, or the original text for unknown variables
+func (l *lexer) substitute(name, original string, out *strings.Builder) {
+	if value, ok := l.lookup(name); ok {
+		out.WriteString(value)
+	} else {
+		out.WriteString(original)
+	}
+}
+
+func indexRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || (r >= '0' && r <= '9')
+}
@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScopeExpand(t *testing.T) {
+	s := newScope()
+	s.args["VERSION"] = "1.2.3"
+	s.args["EMPTY"] = ""
+	s.env["HOME"] = "/root"
+	s.args["HOME"] = "/shadowed"
+
+	tests := []struct {
+		value string
+		want  string
+		errs  int
+	}{
+		{"$VERSION", "1.2.3", 0},
+		{"${VERSION}", "1.2.3", 0},
+		{"v${VERSION}-linux", "v1.2.3-linux", 0},
+		{"$HOME", "/root", 0},
+
+		// ${VAR:-default} and ${VAR-default}
+		{"${VERSION:-dev}", "1.2.3", 0},
+		{"${EMPTY:-dev}", "dev", 0},
+		{"${EMPTY-dev}", "", 0},
+
+		// ${VAR:+alt} and ${VAR+alt}
+		{"${VERSION:+set}", "set", 0},
+		{"${EMPTY:+set}", "", 0},
+		{"${EMPTY+set}", "set", 0},
+
+		// ${VAR:?msg} and ${VAR?msg}
+		{"${VERSION:?required}", "1.2.3", 0},
+		{"${EMPTY:?required}", "", 1},
+		{"${EMPTY:?}", "", 1},
+		{"${EMPTY?required}", "", 0},
+
+		// Undeclared variables are left as written
+		{"$PATH", "$PATH", 0},
+		{"${PATH}", "${PATH}", 0},
+		{"${PATH:-/usr/bin}", "${PATH:-/usr/bin}", 0},
+		{"${PATH:?required}", "${PATH:?required}", 0},
+
+		// Quotes and escapes
+		{`'$VERSION'`, "$VERSION", 0},
+		{`"$VERSION"`, "1.2.3", 0},
+		{`\$VERSION`, "$VERSION", 0},
+		{"${EMPTY:-$VERSION}", "1.2.3", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got := s.expand(tt.value)
+			if got.Expanded != tt.want {
+				t.Errorf("expand(%q) = %q, want %q", tt.value, got.Expanded, tt.want)
+			}
+			if got.Raw != tt.value {
+				t.Errorf("expand(%q).Raw = %q", tt.value, got.Raw)
+			}
+			if errs := s.takeErrors(); len(errs) != tt.errs {
+				t.Errorf("expand(%q) recorded errors %v, want %d", tt.value, errs, tt.errs)
+			}
+		})
+	}
+}
+
+func TestScopeExpandShell(t *testing.T) {
+	s := newScope()
+	s.args["DIR"] = "/src"
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"cd $DIR && make", "cd /src && make"},
+		{`echo "$DIR" '$DIR'`, `echo "/src" '$DIR'`},
+		{`echo \$DIR`, `echo \$DIR`},
+		{"echo $HOME", "echo $HOME"},
+	}
+
+	for _, tt := range tests {
+		if got := s.expandShell(tt.value).Expanded; got != tt.want {
+			t.Errorf("expandShell(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestWordReferences(t *testing.T) {
+	w := Word{Raw: "${A:-$B}/$C/${A}"}
+	got := w.References()
+	want := []string{"A", "C"}
+	if len(got) != len(want) {
+		t.Fatalf("References() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("References() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestParseDockerfileRequiredVariable(t *testing.T) {
+	path := writeDockerfile(t, "FROM golang:1.22\nARG VERSION=\nRUN echo ${VERSION:?set VERSION}\n")
+
+	info, err := ParseDockerfile(path, ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []Warning
+	for _, w := range info.Warnings {
+		if w.Rule == "required-variable" {
+			found = append(found, w)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("got %d required-variable warnings, want 1: %+v", len(found), info.Warnings)
+	}
+	if found[0].Message != "VERSION: set VERSION" || found[0].Location.StartLine != 3 {
+		t.Errorf("warning = %+v", found[0])
+	}
+
+	// A --build-arg satisfies the requirement
+	info, err = ParseDockerfile(path, ParseOptions{BuildArgs: map[string]string{"VERSION": "1.0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range info.Warnings {
+		if w.Rule == "required-variable" {
+			t.Errorf("unexpected warning with VERSION set: %+v", w)
+		}
+	}
+}
+
+// writeDockerfile writes a Dockerfile to a temporary directory and returns its path
+func writeDockerfile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// parseTestDockerfile parses a Dockerfile written to a temporary directory
+func parseTestDockerfile(t *testing.T, content string) *DockerfileInfo {
+	t.Helper()
+
+	info, err := ParseDockerfile(writeDockerfile(t, content), ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Stage Graph:
+============
+
+Stages form a DAG. A stage depends on another stage when it is built
+FROM it, copies files out of it (COPY --from) or mounts it (RUN --mount=from=).
+
+Like "docker build --target", only the stages reachable from the target
+stage take part in the build; the rest (test, lint, ...) are ignored.
+
+Example:
+  FROM golang AS builder        (0)
+  FROM builder AS test          (1) depends on 0
+  FROM alpine AS final          (2) depends on 0 via COPY --from=builder
+  Target "final" reaches stages 0 and 2
+*/
+
+// StageIndex resolves a stage reference (name or numeric index) to its index
+// Returns -1 if ref does not name a stage (e.g. it is an image reference)
+func (info *DockerfileInfo) StageIndex(ref string) int {
+	if stage := info.findStage(ref); stage != nil {
+		return stage.Index
+	}
+
+	if i, err := strconv.Atoi(ref); err == nil && i >= 0 && i < len(info.Stages) {
+		return i
+	}
+
+	return -1
+}
+
+// resolveCopySource decides whether COPY --from names a stage or an external image
+// Only stages defined before the COPY can be referenced, like in Docker
+func (info *DockerfileInfo) resolveCopySource(copy *CopyInstruction) {
+	copy.FromStage = -1
+	copy.FromImage = ""
+	if copy.From == "" {
+		return
+	}
+
+	copy.FromStage = info.StageIndex(copy.From)
+	if copy.FromStage < 0 {
+		copy.FromImage = copy.From
+	}
+}
+
+// TargetStage returns the stage being built (the last stage unless --target is given)
+func (info *DockerfileInfo) TargetStage() *Stage {
+	if info.Target < 0 || info.Target >= len(info.Stages) {
+		return nil
+	}
+	return &info.Stages[info.Target]
+}
+
+// ReachableStages returns the stages needed to build the target, in Dockerfile order
+func (info *DockerfileInfo) ReachableStages() []Stage {
+	if info.TargetStage() == nil {
+		return nil
+	}
+
+	reachable := make(map[int]bool)
+	var visit func(i int)
+	visit = func(i int) {
+		if reachable[i] {
+			return
+		}
+		reachable[i] = true
+		for _, dep := range info.Stages[i].DependsOn {
+			visit(dep)
+		}
+	}
+	visit(info.Target)
+
+	var stages []Stage
+	for i, stage := range info.Stages {
+		if reachable[i] {
+			stages = append(stages, stage)
+		}
+	}
+	return stages
+}
+
+// addDependency records an edge from stage to the stage named by ref, if any
+func (info *DockerfileInfo) addDependency(stage *Stage, ref string) {
+	dep := info.StageIndex(ref)
+	if dep < 0 || dep == stage.Index {
+		return
+	}
+
+	for _, existing := range stage.DependsOn {
+		if existing == dep {
+			return
+		}
+	}
+	stage.DependsOn = append(stage.DependsOn, dep)
+	sort.Ints(stage.DependsOn)
+}
+
+// resolveTarget selects the target stage by name (case-insensitive), like docker build --target
+func (info *DockerfileInfo) resolveTarget(target string) error {
+	info.Target = len(info.Stages) - 1
+	if target == "" {
+		return nil
+	}
+
+	for i, stage := range info.Stages {
+		if strings.EqualFold(stage.Name, target) {
+			info.Target = i
+			return nil
+		}
+	}
+
+	return fmt.Errorf("target stage %q not found", target)
+}
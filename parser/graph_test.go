@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const graphDockerfile = `FROM golang:1.22 AS builder
+RUN go build -o /out/app .
+
+FROM builder AS test
+RUN go test ./...
+
+FROM alpine:3.20 AS assets
+RUN touch /assets.tar
+
+FROM alpine:3.20 AS lint
+RUN echo lint
+
+FROM mcr.microsoft.com/azurelinux/base/core:3.0 AS final
+COPY --from=builder /out/app /usr/bin/app
+COPY --from=2 /assets.tar /srv/
+COPY --from=nginx:1.27 /etc/nginx/mime.types /etc/
+`
+
+func TestStageGraph(t *testing.T) {
+	info := parseTestDockerfile(t, graphDockerfile)
+
+	tests := []struct {
+		stage int
+		want  []int
+	}{
+		{0, nil},
+		{1, []int{0}}, // FROM builder
+		{2, nil},
+		{3, nil},
+		{4, []int{0, 2}}, // COPY --from=builder, COPY --from=2; the image is no edge
+	}
+	for _, tt := range tests {
+		if got := info.Stages[tt.stage].DependsOn; len(got)+len(tt.want) > 0 && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("stage %d DependsOn = %v, want %v", tt.stage, got, tt.want)
+		}
+	}
+
+	copies := info.Stages[4].Copies
+	if copies[2].FromStage != -1 || copies[2].FromImage != "nginx:1.27" {
+		t.Errorf("COPY --from=nginx:1.27 resolved to stage %d, image %q", copies[2].FromStage, copies[2].FromImage)
+	}
+}
+
+func TestReachableStages(t *testing.T) {
+	tests := []struct {
+		target string
+		want   []string
+	}{
+		{"", []string{"builder", "assets", "final"}}, // test and lint are pruned
+		{"test", []string{"builder", "test"}},
+		{"LINT", []string{"lint"}},
+	}
+
+	for _, tt := range tests {
+		info, err := ParseDockerfile(writeDockerfile(t, graphDockerfile), ParseOptions{Target: tt.target})
+		if err != nil {
+			t.Fatalf("target %q: %v", tt.target, err)
+		}
+
+		var got []string
+		for _, stage := range info.ReachableStages() {
+			got = append(got, stage.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("target %q: reachable stages = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestUnknownTarget(t *testing.T) {
+	for _, target := range []string{"release", "1"} {
+		_, err := ParseDockerfile(writeDockerfile(t, graphDockerfile), ParseOptions{Target: target})
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("target %q: error = %v, want target stage not found", target, err)
+		}
+	}
+}
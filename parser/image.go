@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"path"
+	"strings"
+)
+
+// ImageRef is a parsed image reference: [registry/]repository[:tag][@digest]
+// Example: mcr.microsoft.com/oss/go/microsoft/golang:1.23-azurelinux3.0
+//
+//	Registry: mcr.microsoft.com, Repository: oss/go/microsoft/golang, Tag: 1.23-azurelinux3.0
+type ImageRef struct {
+	Registry   string // Registry host, "" for Docker Hub
+	Repository string // Repository path, Docker Hub official images without "library/"
+	Tag        string // Tag, "" if not given
+	Digest     string // Digest (sha256:...), "" if not given
+}
+
+// ParseImageRef splits an image reference into its parts
+// References that still contain unresolved variables give a zero ImageRef
+func ParseImageRef(ref string) ImageRef {
+	var image ImageRef
+	if ref == "" || strings.Contains(ref, "$") {
+		return image
+	}
+
+	if i := strings.Index(ref, "@"); i >= 0 {
+		image.Digest = ref[i+1:]
+		ref = ref[:i]
+	}
+
+	// A tag colon comes after the last slash; earlier colons belong to a registry port
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		image.Tag = ref[i+1:]
+		ref = ref[:i]
+	}
+
+	// The first component is a registry if it looks like a host name
+	if first, rest, ok := strings.Cut(ref, "/"); ok &&
+		(strings.ContainsAny(first, ".:") || first == "localhost") {
+		image.Registry = first
+		ref = rest
+	}
+
+	if image.Registry == "" || image.Registry == "docker.io" || image.Registry == "index.docker.io" {
+		image.Registry = ""
+		ref = strings.TrimPrefix(ref, "library/")
+	}
+	image.Repository = ref
+
+	return image
+}
+
+// Name returns the last component of the repository, e.g. "golang"
+func (r ImageRef) Name() string {
+	if r.Repository == "" {
+		return ""
+	}
+	return path.Base(r.Repository)
+}
+
+// Pinned reports whether the reference has a digest or a tag other than latest
+func (r ImageRef) Pinned() bool {
+	return r.Digest != "" || (r.Tag != "" && r.Tag != "latest")
+}
+
+// String formats the reference back into its canonical short form
+func (r ImageRef) String() string {
+	s := r.Repository
+	if r.Registry != "" {
+		s = r.Registry + "/" + s
+	}
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// Warning is a problem found in the Dockerfile, either by the buildkit parser
+// (empty continuation lines, deprecated syntax) or by Lint
+type Warning struct {
+	Rule     string // Rule name, e.g. "no-empty-continuation" or "curl-pipe-shell"
+	Message  string
+	URL      string // Documentation link, if any
+	Location Location
+}
+
+// parserWarnings converts the warnings buildkit reports while parsing
+func parserWarnings(warnings []parser.Warning) []Warning {
+	var result []Warning
+	for _, w := range warnings {
+		warning := Warning{
+			Rule:    path.Base(strings.TrimSuffix(w.URL, "/")),
+			Message: w.Short,
+			URL:     w.URL,
+		}
+		if w.URL == "" {
+			warning.Rule = "buildkit"
+		}
+		if w.Location != nil {
+			warning.Location = Location{
+				StartLine: w.Location.Start.Line,
+				EndLine:   w.Location.End.Line,
+			}
+		}
+		result = append(result, warning)
+	}
+	return result
+}
+
+// pipeToShell matches a download piped straight into a shell: curl ... | sh
+var pipeToShell = regexp.MustCompile(`\b(curl|wget)\b[^|;&]*\|\s*(sudo\s+)?(\S*/)?(sh|bash|ash|zsh|dash)\b`)
+
+// Lint reports constructs in the stages being built that cannot be converted to a
+// reproducible Dalec spec. Stages the target does not reach are skipped.
+func Lint(info *DockerfileInfo) []Warning {
+	var warnings []Warning
+
+	for _, stage := range info.ReachableStages() {
+		if stage.BaseStage < 0 && !isPinnedImage(stage.From.Expanded) {
+			warnings = append(warnings, Warning{
+				Rule:     "unpinned-base-image",
+				Message:  fmt.Sprintf("base image %s is not pinned to a version (missing or latest tag)", stage.From.Expanded),
+				Location: stage.Location,
+			})
+		}
+
+		for _, run := range stage.Runs {
+			scripts := []string{run.Command.Expanded}
+			for _, h := range run.Heredocs {
+				scripts = append(scripts, h.Content.Expanded)
+			}
+
+			for _, script := range scripts {
+				if pipeToShell.MatchString(script) {
+					warnings = append(warnings, Warning{
+						Rule:     "curl-pipe-shell",
+						Message:  "RUN pipes a downloaded script into a shell; package the tool as a dependency or source instead",
+						Location: run.Location,
+					})
+				}
+
+				if unpinned := unpinnedAptPackages(script); len(unpinned) > 0 {
+					warnings = append(warnings, Warning{
+						Rule:     "unpinned-apt-packages",
+						Message:  fmt.Sprintf("apt-get install without versions: %s", strings.Join(unpinned, ", ")),
+						Location: run.Location,
+					})
+				}
+			}
+		}
+
+		for _, copy := range stage.Copies {
+			if copy.FromImage != "" && !isPinnedImage(copy.FromImage) {
+				warnings = append(warnings, Warning{
+					Rule:     "unpinned-base-image",
+					Message:  fmt.Sprintf("%s --from image %s is not pinned to a version (missing or latest tag)", copy.Type, copy.FromImage),
+					Location: copy.Location,
+				})
+			}
+
+			if copy.Type != "ADD" || copy.Checksum != "" {
+				continue
+			}
+			for _, src := range copy.Source {
+				if isRemoteSource(src.Expanded) {
+					warnings = append(warnings, Warning{
+						Rule:     "add-remote-without-checksum",
+						Message:  fmt.Sprintf("ADD downloads %s without --checksum", src.Expanded),
+						Location: copy.Location,
+					})
+				}
+			}
+		}
+	}
+
+	return warnings
+}
+
+// isPinnedImage reports whether an image reference has a digest or a non-latest tag
+// scratch and references still containing unresolved variables are not checked
+func isPinnedImage(ref string) bool {
+	if ref == "" || strings.EqualFold(ref, "scratch") || strings.Contains(ref, "$") {
+		return true
+	}
+	return ParseImageRef(ref).Pinned()
+}
+
+// isRemoteSource reports whether an ADD source is downloaded rather than taken from the context
+func isRemoteSource(src string) bool {
+	return strings.HasPrefix(src, "http://") ||
+		strings.HasPrefix(src, "https://") ||
+		strings.HasPrefix(src, "git@")
+}
+
+// unpinnedAptPackages returns the packages of "apt-get install" commands that have no =version
+func unpinnedAptPackages(script string) []string {
+	var unpinned []string
+	commands, _ := parseShellList(script)
+
+	for _, cmd := range commands {
+		install, ok := cmd.PackageInstall()
+		if !ok || (install.Manager != "apt-get" && install.Manager != "apt") {
+			continue
+		}
+		for _, pkg := range install.Packages {
+			if pkg.Version == "" {
+				unpinned = append(unpinned, pkg.Name)
+			}
+		}
+	}
+
+	return unpinned
+}
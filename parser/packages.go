@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"path"
+	"strings"
+)
+
+// PackageInstall is an OS package manager install command
+// Example: apt-get install -y --no-install-recommends make=4.3-4 git
+type PackageInstall struct {
+	Manager  string    // apt-get, apt, tdnf, dnf, yum, microdnf or apk
+	Packages []Package // Requested packages in command order
+}
+
+// Package is a package name with an optional version pin
+type Package struct {
+	Name    string // Package name as the Dockerfile's distro knows it
+	Op      string // Version operator: "=", ">=", "<=", ">", "<" or "~" (apk), "" if unpinned
+	Version string // Pinned version, "" if unpinned
+}
+
+// installCommands maps each package manager to its install subcommand
+var installCommands = map[string]string{
+	"apt-get":  "install",
+	"apt":      "install",
+	"tdnf":     "install",
+	"dnf":      "install",
+	"yum":      "install",
+	"microdnf": "install",
+	"apk":      "add",
+}
+
+// valueFlags are package manager options that take the next word as their value
+var valueFlags = map[string]bool{
+	// apt-get, apt (-t is also apk's short form of --virtual)
+	"-o": true, "-t": true, "-c": true, "--target-release": true, "--config-file": true,
+	// dnf, yum, tdnf, microdnf
+	"--enablerepo": true, "--disablerepo": true, "--releasever": true, "--installroot": true, "--repo": true, "--setopt": true,
+	// apk
+	"-X": true, "--repository": true, "-p": true, "--root": true, "--virtual": true,
+}
+
+// versionOps are the version operators package managers accept after a name, longest first
+var versionOps = []string{">=", "<=", "=", ">", "<", "~"}
+
+// PackageInstall recognises "apt-get install", "apk add", "tdnf install" and friends
+// Flags are skipped; local files, URLs and unexpanded variables are not packages
+func (cmd ShellCommand) PackageInstall() (PackageInstall, bool) {
+	args := cmd.Args
+	if len(args) > 0 && args[0] == "sudo" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return PackageInstall{}, false
+	}
+
+	manager := path.Base(args[0])
+	subcommand, ok := installCommands[manager]
+	if !ok {
+		return PackageInstall{}, false
+	}
+
+	install := PackageInstall{Manager: manager}
+	found := false
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") {
+			if valueFlags[arg] {
+				i++
+			}
+			continue
+		}
+
+		if !found {
+			if arg != subcommand {
+				return PackageInstall{}, false
+			}
+			found = true
+			continue
+		}
+
+		if strings.ContainsAny(arg, "/$") {
+			continue
+		}
+		install.Packages = append(install.Packages, parsePackage(arg))
+	}
+
+	return install, found
+}
+
+// parsePackage splits a name=version style argument into name and pin
+func parsePackage(arg string) Package {
+	i := strings.IndexAny(arg, "<>=~")
+	if i <= 0 {
+		return Package{Name: arg}
+	}
+
+	rest := arg[i:]
+	for _, op := range versionOps {
+		if strings.HasPrefix(rest, op) {
+			return Package{Name: arg[:i], Op: op, Version: strings.TrimPrefix(rest, op)}
+		}
+	}
+	return Package{Name: arg}
+}
+
+// PackageInstalls returns the package manager install commands of a shell-form RUN
+func (run RunInstruction) PackageInstalls() []PackageInstall {
+	var installs []PackageInstall
+	for _, cmd := range run.Commands {
+		if install, ok := cmd.PackageInstall(); ok {
+			installs = append(installs, install)
+		}
+	}
+	return installs
+}
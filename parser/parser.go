@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"os"
+	"path"
 	"strings"
 
 	"github.com/moby/buildkit/frontend/dockerfile/parser"
@@ -37,37 +38,91 @@ Example:
 
 // DockerfileInfo contains parsed information from a Dockerfile
 type DockerfileInfo struct {
-	Stages []Stage           // Multi-stage build stages
-	Args   map[string]string // Global ARG declarations
-	Labels map[string]string // LABEL metadata
+	Path         string            // Dockerfile path as given to ParseDockerfile
+	Stages       []Stage           // Multi-stage build stages
+	Instructions []Instruction     // Every instruction in file order
+	Args         map[string]string // Global ARG declarations (after --build-arg overrides)
+	Labels       map[string]string // LABEL metadata
+	Warnings     []Warning         // Warnings reported by the buildkit parser and failed ${VAR:?msg} substitutions
+	Target       int               // Index of the stage being built (see TargetStage)
+}
+
+// Location is the position of an instruction in the Dockerfile
+type Location struct {
+	StartLine int    // First line of the instruction (1-based)
+	EndLine   int    // Last line, including continuation lines and heredocs
+	Original  string // Instruction text as written (first line for heredocs)
+}
+
+// Instruction is a single Dockerfile instruction with its source position
+type Instruction struct {
+	Keyword  string // Upper-case instruction name, e.g. "RUN"
+	Stage    int    // Index of the enclosing stage, -1 before the first FROM
+	Location Location
 }
 
 // Stage represents a build stage in a multi-stage Dockerfile
 type Stage struct {
-	Name       string            // Stage name from "AS <name>"
-	From       string            // Base image
-	Platform   string            // Platform from --platform flag
-	Args       map[string]string // ARG in this stage
-	Env        map[string]string // ENV variables
-	Workdir    string            // WORKDIR path
-	Runs       []string          // RUN commands
-	Copies     []CopyInstruction // COPY/ADD instructions
-	Entrypoint []string          // ENTRYPOINT
-	Cmd        []string          // CMD
-	Expose     []string          // EXPOSE ports
+	Name        string            // Stage name from "AS <name>"
+	Location    Location          // Position of the FROM instruction
+	Index       int               // Position in the Dockerfile, usable in COPY --from=<index>
+	From        Word              // Base image
+	Image       ImageRef          // Parsed base image, zero if built FROM a stage or unresolved
+	BaseStage   int               // Index of the stage used as base image, or -1
+	DependsOn   []int             // Indices of stages this stage needs (FROM, COPY --from, RUN --mount from)
+	Platform    string            // Platform from --platform flag
+	Args        map[string]string // ARG in this stage (after --build-arg overrides)
+	Env         map[string]Word   // ENV variables
+	Workdir     Word              // WORKDIR path
+	Runs        []RunInstruction  // RUN instructions
+	Copies      []CopyInstruction // COPY/ADD instructions
+	Entrypoint  []string          // ENTRYPOINT
+	Cmd         []string          // CMD
+	Expose      []string          // EXPOSE ports
+	User        Word              // USER (user[:group])
+	Volumes     []string          // VOLUME paths
+	Healthcheck *Healthcheck      // HEALTHCHECK, nil if not set
+	StopSignal  string            // STOPSIGNAL
+	Shell       []string          // SHELL used for shell-form commands (default: /bin/sh -c)
+	OnBuild     []string          // ONBUILD triggers (instruction text)
+	Maintainer  string            // MAINTAINER (deprecated in favor of LABEL)
+}
+
+// Healthcheck represents a HEALTHCHECK instruction
+// Example: HEALTHCHECK --interval=30s --retries=3 CMD curl -f http://localhost/
+type Healthcheck struct {
+	Location      Location // Position in the Dockerfile
+	Disabled      bool     // HEALTHCHECK NONE
+	Command       []string // Check command (shell form is wrapped in SHELL)
+	Interval      string   // --interval
+	Timeout       string   // --timeout
+	StartPeriod   string   // --start-period
+	StartInterval string   // --start-interval
+	Retries       string   // --retries
 }
 
 // CopyInstruction represents a COPY or ADD instruction
 type CopyInstruction struct {
-	Type   string   // "COPY" or "ADD"
-	From   string   // Source stage (--from=<stage>)
-	Source []string // Source paths
-	Dest   string   // Destination path
+	Type      string    // "COPY" or "ADD"
+	Location  Location  // Position in the Dockerfile
+	From      string    // Raw --from value (stage name, stage index or image)
+	FromStage int       // Index of the --from stage, or -1
+	FromImage string    // External image for --from=<image>, e.g. golang:1.22
+	Source    []Word    // Source paths
+	Dest      Word      // Destination path
+	Heredocs  []Heredoc // Inline files: COPY <<EOF /etc/app.conf
+	Checksum  string    // ADD --checksum for remote sources
+}
+
+// ParseOptions controls how Dockerfile values are evaluated
+type ParseOptions struct {
+	BuildArgs map[string]string // --build-arg overrides for declared ARGs
+	Target    string            // Stage to build, like docker build --target (default: last stage)
 }
 
 // ParseDockerfile uses buildkit parser to parse a Dockerfile
 // The buildkit parser handles all the complex parsing for us
-func ParseDockerfile(filepath string) (*DockerfileInfo, error) {
+func ParseDockerfile(filepath string, opts ParseOptions) (*DockerfileInfo, error) {
 	f, err := os.Open(filepath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open Dockerfile: %w", err)
@@ -85,74 +140,205 @@ func ParseDockerfile(filepath string) (*DockerfileInfo, error) {
 
 	// Initialize our data structure
 	info := &DockerfileInfo{
-		Args:   make(map[string]string),
-		Labels: make(map[string]string),
-		Stages: []Stage{},
+		Path:     filepath,
+		Args:     make(map[string]string),
+		Labels:   make(map[string]string),
+		Stages:   []Stage{},
+		Warnings: parserWarnings(result.Warnings),
+	}
+
+	// Global ARGs are only visible to FROM lines; each stage gets its own scope
+	global := newScope()
+	for _, name := range predefinedArgs {
+		if value, ok := opts.BuildArgs[name]; ok {
+			global.args[name] = value
+		}
 	}
 
 	var currentStage *Stage
+	var stageScope *scope
 
 	// Walk the AST - each child is a Dockerfile instruction
 	for _, node := range result.AST.Children {
 		instruction := strings.ToUpper(node.Value)
 
+		stageIndex := -1
+		if instruction == "FROM" {
+			stageIndex = len(info.Stages)
+		} else if currentStage != nil {
+			stageIndex = currentStage.Index
+		}
+		info.Instructions = append(info.Instructions, Instruction{
+			Keyword:  instruction,
+			Stage:    stageIndex,
+			Location: nodeLocation(node),
+		})
+
 		switch instruction {
 		case "FROM":
-			currentStage = parseFromInstruction(node)
+			currentStage = parseFromInstruction(node, global)
+			currentStage.Index = len(info.Stages)
+			currentStage.Location = nodeLocation(node)
+			stageScope = newScope()
+
+			// A stage built on another stage inherits its ENV and WORKDIR
+			if parent := info.findStage(currentStage.From.Expanded); parent != nil {
+				for k, v := range parent.Env {
+					currentStage.Env[k] = v
+					stageScope.env[k] = v.Expanded
+				}
+				currentStage.Workdir = parent.Workdir
+				// Image config is inherited as well
+				currentStage.User = parent.User
+				currentStage.Volumes = append([]string{}, parent.Volumes...)
+				currentStage.Healthcheck = parent.Healthcheck
+				currentStage.StopSignal = parent.StopSignal
+				currentStage.Shell = parent.Shell
+				currentStage.BaseStage = parent.Index
+				currentStage.DependsOn = []int{parent.Index}
+			} else {
+				currentStage.Image = ParseImageRef(currentStage.From.Expanded)
+			}
+
 			info.Stages = append(info.Stages, *currentStage)
 			// Update pointer to the stage in the slice
 			currentStage = &info.Stages[len(info.Stages)-1]
 
 		case "ARG":
-			key, value := parseKeyValue(node.Next)
-			info.Args[key] = value
-			if currentStage != nil {
-				currentStage.Args[key] = value
+			for _, arg := range parseArgs(node.Next) {
+				if currentStage == nil {
+					info.Args[arg.Key] = global.declareArg(arg.Key, arg.Value, arg.HasValue, nil, opts.BuildArgs)
+				} else {
+					currentStage.Args[arg.Key] = stageScope.declareArg(arg.Key, arg.Value, arg.HasValue, global, opts.BuildArgs)
+				}
 			}
 
 		case "ENV":
 			if currentStage != nil {
-				key, value := parseKeyValue(node.Next)
-				currentStage.Env[key] = value
+				// All values are expanded before any of them is set, so
+				// "ENV A=1 B=$A" sees the previous A like Docker does
+				pairs := parseKeyValues(node.Next)
+				words := make([]Word, len(pairs))
+				for i, pair := range pairs {
+					words[i] = stageScope.expand(pair.Value)
+				}
+				for i, pair := range pairs {
+					currentStage.Env[pair.Key] = words[i]
+					stageScope.env[pair.Key] = words[i].Expanded
+				}
 			}
 
 		case "WORKDIR":
 			if currentStage != nil && node.Next != nil {
-				currentStage.Workdir = node.Next.Value
+				workdir := stageScope.expand(node.Next.Value)
+				// Relative paths are relative to the previous WORKDIR
+				if !path.IsAbs(workdir.Expanded) && currentStage.Workdir.Expanded != "" {
+					workdir.Expanded = path.Join(currentStage.Workdir.Expanded, workdir.Expanded)
+				}
+				currentStage.Workdir = workdir
 			}
 
 		case "RUN":
 			if currentStage != nil {
 				// buildkit already parsed the command for us
-				cmd := reconstructCommand(node.Next)
-				currentStage.Runs = append(currentStage.Runs, cmd)
+				run := parseRunInstruction(node, stageScope)
+				run.Workdir = currentStage.Workdir
+				currentStage.Runs = append(currentStage.Runs, run)
+				for _, mount := range run.Mounts {
+					if mount.From != "" {
+						info.addDependency(currentStage, mount.From)
+					}
+				}
 			}
 
 		case "COPY", "ADD":
 			if currentStage != nil {
-				copy := parseCopyInstruction(node, instruction)
+				copy := parseCopyInstruction(node, instruction, stageScope)
+				info.resolveCopySource(&copy)
 				currentStage.Copies = append(currentStage.Copies, copy)
+				if copy.FromStage >= 0 {
+					info.addDependency(currentStage, copy.From)
+				}
 			}
 
 		case "ENTRYPOINT":
 			if currentStage != nil {
-				currentStage.Entrypoint = parseCommandArray(node)
+				currentStage.Entrypoint = parseCommandArray(node, currentStage.Shell)
 			}
 
 		case "CMD":
 			if currentStage != nil {
-				currentStage.Cmd = parseCommandArray(node)
+				currentStage.Cmd = parseCommandArray(node, currentStage.Shell)
 			}
 
 		case "EXPOSE":
+			if currentStage != nil {
+				for n := node.Next; n != nil; n = n.Next {
+					currentStage.Expose = append(currentStage.Expose, stageScope.expand(n.Value).Expanded)
+				}
+			}
+
+		case "USER":
 			if currentStage != nil && node.Next != nil {
-				currentStage.Expose = append(currentStage.Expose, node.Next.Value)
+				currentStage.User = stageScope.expand(node.Next.Value)
+			}
+
+		case "VOLUME":
+			if currentStage != nil {
+				for n := node.Next; n != nil; n = n.Next {
+					currentStage.Volumes = append(currentStage.Volumes, stageScope.expand(n.Value).Expanded)
+				}
+			}
+
+		case "HEALTHCHECK":
+			if currentStage != nil {
+				currentStage.Healthcheck = parseHealthcheck(node, currentStage.Shell)
+			}
+
+		case "STOPSIGNAL":
+			if currentStage != nil && node.Next != nil {
+				currentStage.StopSignal = stageScope.expand(node.Next.Value).Expanded
+			}
+
+		case "SHELL":
+			if currentStage != nil {
+				currentStage.Shell = parseCommandArray(node, nil)
+			}
+
+		case "ONBUILD":
+			if currentStage != nil {
+				// The trigger is only run by images built FROM this one
+				_, trigger, _ := strings.Cut(strings.TrimSpace(node.Original), " ")
+				currentStage.OnBuild = append(currentStage.OnBuild, strings.TrimSpace(trigger))
+			}
+
+		case "MAINTAINER":
+			if currentStage != nil && node.Next != nil {
+				currentStage.Maintainer = node.Next.Value
 			}
 
 		case "LABEL":
-			key, value := parseKeyValue(node.Next)
-			info.Labels[key] = strings.Trim(value, "\"")
+			labelScope := global
+			if stageScope != nil {
+				labelScope = stageScope
+			}
+			for _, pair := range parseKeyValues(node.Next) {
+				info.Labels[labelScope.expand(pair.Key).Expanded] = labelScope.expand(pair.Value).Expanded
+			}
 		}
+
+		// The real build would fail on these, keep going and report them
+		for _, err := range append(global.takeErrors(), stageScope.takeErrors()...) {
+			info.Warnings = append(info.Warnings, Warning{
+				Rule:     "required-variable",
+				Message:  err.Error(),
+				Location: nodeLocation(node),
+			})
+		}
+	}
+
+	if err := info.resolveTarget(opts.Target); err != nil {
+		return nil, err
 	}
 
 	return info, nil
@@ -160,27 +346,29 @@ func ParseDockerfile(filepath string) (*DockerfileInfo, error) {
 
 // parseFromInstruction extracts information from a FROM instruction
 // Example: FROM --platform=linux/amd64 golang:1.21 AS builder
-func parseFromInstruction(node *parser.Node) *Stage {
+// Only global ARGs are visible to FROM, so values are expanded in that scope
+func parseFromInstruction(node *parser.Node, global *scope) *Stage {
 	stage := &Stage{
-		Args:   make(map[string]string),
-		Env:    make(map[string]string),
-		Copies: []CopyInstruction{},
-		Runs:   []string{},
-		Expose: []string{},
+		BaseStage: -1,
+		Args:      make(map[string]string),
+		Env:       make(map[string]Word),
+		Copies:    []CopyInstruction{},
+		Runs:      []RunInstruction{},
+		Expose:    []string{},
 	}
 
 	// Check for flags (buildkit already parsed them)
 	if node.Flags != nil {
 		for _, flag := range node.Flags {
 			if strings.HasPrefix(flag, "--platform=") {
-				stage.Platform = strings.TrimPrefix(flag, "--platform=")
+				stage.Platform = global.expand(strings.TrimPrefix(flag, "--platform=")).Expanded
 			}
 		}
 	}
 
 	// Get base image (first argument)
 	if node.Next != nil {
-		stage.From = node.Next.Value
+		stage.From = global.expand(node.Next.Value)
 
 		// Check for "AS <name>" clause
 		n := node.Next.Next
@@ -194,30 +382,45 @@ func parseFromInstruction(node *parser.Node) *Stage {
 
 // parseCopyInstruction extracts COPY/ADD instruction details
 // Example: COPY --from=builder /app/bin /usr/local/bin
-func parseCopyInstruction(node *parser.Node, instType string) CopyInstruction {
+func parseCopyInstruction(node *parser.Node, instType string, s *scope) CopyInstruction {
 	copy := CopyInstruction{
-		Type:   instType,
-		Source: []string{},
+		Type:      instType,
+		Location:  nodeLocation(node),
+		FromStage: -1,
+		Source:    []Word{},
 	}
 
 	// Check for --from flag (buildkit already parsed it)
 	if node.Flags != nil {
 		for _, flag := range node.Flags {
 			if strings.HasPrefix(flag, "--from=") {
-				copy.From = strings.TrimPrefix(flag, "--from=")
+				copy.From = s.expand(strings.TrimPrefix(flag, "--from=")).Expanded
+			}
+			if strings.HasPrefix(flag, "--checksum=") {
+				copy.Checksum = s.expand(strings.TrimPrefix(flag, "--checksum=")).Expanded
 			}
 		}
 	}
 
 	// Walk through arguments: all but last are sources, last is dest
-	var args []string
+	var args []Word
 	for n := node.Next; n != nil; n = n.Next {
-		args = append(args, n.Value)
+		args = append(args, s.expand(n.Value))
 	}
 
 	if len(args) > 0 {
 		copy.Dest = args[len(args)-1]
-		copy.Source = args[:len(args)-1]
+		// Heredoc markers (<<EOF) are not paths, their content is kept in Heredocs
+		for _, src := range args[:len(args)-1] {
+			if len(node.Heredocs) > 0 && strings.HasPrefix(src.Raw, "<<") {
+				continue
+			}
+			copy.Source = append(copy.Source, src)
+		}
+	}
+
+	for _, h := range node.Heredocs {
+		copy.Heredocs = append(copy.Heredocs, newHeredoc(h, s))
 	}
 
 	return copy
@@ -225,22 +428,72 @@ func parseCopyInstruction(node *parser.Node, instType string) CopyInstruction {
 
 // parseCommandArray handles both JSON and shell format commands
 // buildkit tells us if it's JSON via node.Attributes["json"]
-func parseCommandArray(node *parser.Node) []string {
+func parseCommandArray(node *parser.Node, shell []string) []string {
+	isJSON := node.Attributes != nil && node.Attributes["json"]
+	return commandArray(node.Next, isJSON, shell)
+}
+
+// commandArray builds an exec-form command from argument nodes
+// Shell form commands are wrapped in the stage's SHELL (default: /bin/sh -c)
+func commandArray(args *parser.Node, isJSON bool, shell []string) []string {
 	// Check if buildkit detected JSON format (e.g., ["cmd", "arg1", "arg2"])
-	if node.Attributes != nil && node.Attributes["json"] {
+	if isJSON {
 		var result []string
-		for n := node.Next; n != nil; n = n.Next {
+		for n := args; n != nil; n = n.Next {
 			result = append(result, n.Value)
 		}
 		return result
 	}
 
 	// Shell format - wrap in shell
-	cmd := reconstructCommand(node.Next)
-	if cmd != "" {
-		return []string{"/bin/sh", "-c", cmd}
+	cmd := reconstructCommand(args)
+	if cmd == "" {
+		return nil
+	}
+	if len(shell) == 0 {
+		shell = []string{"/bin/sh", "-c"}
+	}
+	return append(append([]string{}, shell...), cmd)
+}
+
+// parseHealthcheck extracts a HEALTHCHECK instruction
+// buildkit gives us node.Next.Value = "CMD" or "NONE", followed by the command
+func parseHealthcheck(node *parser.Node, shell []string) *Healthcheck {
+	hc := &Healthcheck{Location: nodeLocation(node)}
+
+	if node.Next == nil || strings.EqualFold(node.Next.Value, "NONE") {
+		hc.Disabled = true
+		return hc
+	}
+
+	for _, flag := range node.Flags {
+		name, value, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		switch name {
+		case "interval":
+			hc.Interval = value
+		case "timeout":
+			hc.Timeout = value
+		case "start-period":
+			hc.StartPeriod = value
+		case "start-interval":
+			hc.StartInterval = value
+		case "retries":
+			hc.Retries = value
+		}
+	}
+
+	isJSON := node.Attributes != nil && node.Attributes["json"]
+	hc.Command = commandArray(node.Next.Next, isJSON, shell)
+	return hc
+}
+
+// nodeLocation returns the line range and original text of an instruction node
+func nodeLocation(node *parser.Node) Location {
+	return Location{
+		StartLine: node.StartLine,
+		EndLine:   node.EndLine,
+		Original:  node.Original,
 	}
-	return nil
 }
 
 // reconstructCommand joins node values back into a single command string
@@ -252,27 +505,57 @@ func reconstructCommand(node *parser.Node) string {
 	return strings.Join(parts, " ")
 }
 
-// parseKeyValue extracts key=value or key value pairs
-func parseKeyValue(node *parser.Node) (string, string) {
-	if node == nil {
-		return "", ""
-	}
+// keyValue is a single pair from an ENV, ARG or LABEL instruction
+type keyValue struct {
+	Key      string
+	Value    string
+	HasValue bool // false for "ARG NAME" without a default
+}
 
-	fullValue := reconstructCommand(node)
+// parseKeyValues extracts every pair from an ENV or LABEL instruction
+// buildkit stores each pair as a node triple: key -> value -> separator
+// Example: ENV CGO_ENABLED=0 GOOS=linux gives CGO_ENABLED -> 0 -> = -> GOOS -> linux -> =
+func parseKeyValues(node *parser.Node) []keyValue {
+	var pairs []keyValue
 
-	// Try splitting on =
-	if strings.Contains(fullValue, "=") {
-		parts := strings.SplitN(fullValue, "=", 2)
-		return parts[0], parts[1]
+	for n := node; n != nil; {
+		pair := keyValue{Key: n.Value, HasValue: true}
+		if n.Next != nil {
+			pair.Value = n.Next.Value
+		}
+		pairs = append(pairs, pair)
+
+		if n.Next == nil || n.Next.Next == nil {
+			break
+		}
+		n = n.Next.Next.Next
 	}
 
-	// Try splitting on space
-	parts := strings.SplitN(fullValue, " ", 2)
-	if len(parts) == 2 {
-		return parts[0], parts[1]
+	return pairs
+}
+
+// parseArgs extracts every declaration from an ARG instruction
+// buildkit keeps one node per word: NAME or NAME=default
+func parseArgs(node *parser.Node) []keyValue {
+	var args []keyValue
+
+	for n := node; n != nil; n = n.Next {
+		key, value, found := strings.Cut(n.Value, "=")
+		args = append(args, keyValue{Key: key, Value: value, HasValue: found})
 	}
 
-	return fullValue, ""
+	return args
+}
+
+// findStage returns the stage with the given name, or nil
+// Stage names are case-insensitive, like in Docker
+func (info *DockerfileInfo) findStage(name string) *Stage {
+	for i := range info.Stages {
+		if info.Stages[i].Name != "" && strings.EqualFold(info.Stages[i].Name, name) {
+			return &info.Stages[i]
+		}
+	}
+	return nil
 }
 
 // PrintDockerfileInfo displays parsed Dockerfile information
@@ -301,7 +584,11 @@ func PrintDockerfileInfo(info *DockerfileInfo) {
 		fmt.Println()
 	}
 
-	fmt.Printf("🏗️  Build Stages: %d\n\n", len(info.Stages))
+	fmt.Printf("🏗️  Build Stages: %d\n", len(info.Stages))
+	if target := info.TargetStage(); target != nil {
+		fmt.Printf("🎯 Target: stage %d (%d stages reachable)\n", target.Index, len(info.ReachableStages()))
+	}
+	fmt.Println()
 
 	for i, stage := range info.Stages {
 		stageName := stage.Name
@@ -310,16 +597,20 @@ func PrintDockerfileInfo(info *DockerfileInfo) {
 		}
 
 		fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
-		fmt.Printf("Stage %d: %s\n", i, stageName)
+		fmt.Printf("Stage %d: %s (line %d)\n", i, stageName, stage.Location.StartLine)
 		fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
-		fmt.Printf("  📦 Base: %s\n", stage.From)
+		fmt.Printf("  📦 Base: %s\n", formatWord(stage.From))
+
+		if len(stage.DependsOn) > 0 {
+			fmt.Printf("  🔗 Depends on stages: %v\n", stage.DependsOn)
+		}
 
 		if stage.Platform != "" {
 			fmt.Printf("  🖥️  Platform: %s\n", stage.Platform)
 		}
 
-		if stage.Workdir != "" {
-			fmt.Printf("  📁 Workdir: %s\n", stage.Workdir)
+		if stage.Workdir.Raw != "" {
+			fmt.Printf("  📁 Workdir: %s\n", formatWord(stage.Workdir))
 		}
 
 		if len(stage.Args) > 0 {
@@ -332,14 +623,20 @@ func PrintDockerfileInfo(info *DockerfileInfo) {
 		if len(stage.Env) > 0 {
 			fmt.Println("  🌍 ENV:")
 			for k, v := range stage.Env {
-				fmt.Printf("     • %s = %s\n", k, v)
+				fmt.Printf("     • %s = %s\n", k, formatWord(v))
 			}
 		}
 
 		if len(stage.Runs) > 0 {
 			fmt.Printf("  ⚙️  RUN commands: %d\n", len(stage.Runs))
 			for _, run := range stage.Runs {
-				fmt.Printf("     • %s\n", truncate(run, 70))
+				fmt.Printf("     • L%d %s\n", run.Location.StartLine, truncate(run.Command.Expanded, 70))
+				for _, h := range run.Heredocs {
+					fmt.Printf("       ↳ heredoc %s (%d lines)\n", h.Name, strings.Count(h.Content.Expanded, "\n"))
+				}
+				for _, mount := range run.Mounts {
+					fmt.Printf("       ↳ mount %s → %s\n", mount.Type, mount.Target)
+				}
 			}
 		}
 
@@ -347,10 +644,15 @@ func PrintDockerfileInfo(info *DockerfileInfo) {
 			fmt.Printf("  📋 COPY/ADD: %d\n", len(stage.Copies))
 			for _, copy := range stage.Copies {
 				fromInfo := ""
-				if copy.From != "" {
-					fromInfo = fmt.Sprintf(" (from %s)", copy.From)
+				if copy.FromStage >= 0 {
+					fromInfo = fmt.Sprintf(" (from stage %d)", copy.FromStage)
+				} else if copy.FromImage != "" {
+					fromInfo = fmt.Sprintf(" (from image %s)", copy.FromImage)
+				}
+				fmt.Printf("     • %s: %v → %s%s\n", copy.Type, copy.Source, copy.Dest.Expanded, fromInfo)
+				for _, h := range copy.Heredocs {
+					fmt.Printf("       ↳ heredoc %s (%d bytes)\n", h.Name, len(h.Content.Expanded))
 				}
-				fmt.Printf("     • %s: %v → %s%s\n", copy.Type, copy.Source, copy.Dest, fromInfo)
 			}
 		}
 
@@ -366,10 +668,42 @@ func PrintDockerfileInfo(info *DockerfileInfo) {
 			fmt.Printf("  🌐 Expose: %v\n", stage.Expose)
 		}
 
+		if stage.User.Raw != "" {
+			fmt.Printf("  👤 User: %s\n", formatWord(stage.User))
+		}
+
+		if len(stage.Volumes) > 0 {
+			fmt.Printf("  💾 Volumes: %v\n", stage.Volumes)
+		}
+
+		if stage.Healthcheck != nil {
+			if stage.Healthcheck.Disabled {
+				fmt.Println("  🩺 Healthcheck: disabled")
+			} else {
+				fmt.Printf("  🩺 Healthcheck: %v\n", stage.Healthcheck.Command)
+			}
+		}
+
+		if stage.StopSignal != "" {
+			fmt.Printf("  🛑 Stop signal: %s\n", stage.StopSignal)
+		}
+
+		if len(stage.OnBuild) > 0 {
+			fmt.Printf("  🪝 ONBUILD triggers: %d\n", len(stage.OnBuild))
+		}
+
 		fmt.Println()
 	}
 }
 
+// formatWord shows the expanded value, followed by the raw one when they differ
+func formatWord(w Word) string {
+	if w.Raw == w.Expanded {
+		return w.Expanded
+	}
+	return fmt.Sprintf("%s (%s)", w.Expanded, w.Raw)
+}
+
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
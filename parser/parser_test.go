@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestMultiPairInstructions(t *testing.T) {
+	path := writeDockerfile(t, `ARG REGISTRY=docker.io BASE_TAG=3.20
+FROM ${REGISTRY}/library/alpine:${BASE_TAG}
+ARG VERSION=1.0 COMMIT
+ENV A=0
+ENV A=1 B="two words" C=$A
+ENV LEGACY value with spaces
+LABEL org.opencontainers.image.version=$VERSION "description"="an app" maintainer=me
+`)
+	info, err := ParseDockerfile(path, ParseOptions{BuildArgs: map[string]string{"COMMIT": "abc", "BASE_TAG": "3.21"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := info.Stages[0].From.Expanded; got != "docker.io/library/alpine:3.21" {
+		t.Errorf("FROM = %q, want both global ARGs expanded", got)
+	}
+
+	stage := info.Stages[0]
+	for key, want := range map[string]string{"VERSION": "1.0", "COMMIT": "abc"} {
+		if stage.Args[key] != want {
+			t.Errorf("ARG %s = %q, want %q", key, stage.Args[key], want)
+		}
+	}
+
+	for key, want := range map[string]string{
+		"A":      "1",
+		"B":      "two words",
+		"C":      "0", // values are expanded before any pair of the same ENV is set
+		"LEGACY": "value with spaces",
+	} {
+		if got := stage.Env[key].Expanded; got != want {
+			t.Errorf("ENV %s = %q, want %q", key, got, want)
+		}
+	}
+
+	for key, want := range map[string]string{
+		"org.opencontainers.image.version": "1.0",
+		"description":                      "an app",
+		"maintainer":                       "me",
+	} {
+		if got := info.Labels[key]; got != want {
+			t.Errorf("LABEL %s = %q, want %q", key, got, want)
+		}
+	}
+}
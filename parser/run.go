@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"encoding/csv"
+	"path"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// RunInstruction represents a RUN instruction
+// Example: RUN --mount=type=cache,target=/root/.cache/go-build go build ./...
+type RunInstruction struct {
+	Location Location       // Position in the Dockerfile
+	Command  Word           // Command line (exec form arguments joined by spaces)
+	Exec     bool           // JSON exec form: RUN ["executable", "arg"]
+	Args     []string       // Exec form arguments
+	Commands []ShellCommand // Shell form split at &&, || and ; (nil if it could not be parsed)
+	Heredocs []Heredoc      // Heredoc bodies: RUN <<EOF
+	Mounts   []Mount        // --mount specs
+	Network  string         // --network mode (default, none, host)
+	Security string         // --security mode (sandbox, insecure)
+	Workdir  Word           // WORKDIR the command starts in (a cd in an earlier RUN does not carry over)
+}
+
+// Heredoc is an inline document attached to a RUN, COPY or ADD instruction
+type Heredoc struct {
+	Name    string // Delimiter, e.g. EOF
+	Content Word   // Body between the delimiters
+	Expand  bool   // Variables are expanded (delimiter was not quoted)
+	Chomp   bool   // Leading tabs are stripped (<<-EOF)
+}
+
+// Mount represents a RUN --mount specification
+// Example: --mount=type=cache,id=gomod,target=/go/pkg/mod,sharing=locked
+type Mount struct {
+	Type     string // bind (default), cache, tmpfs, secret or ssh
+	Target   string // Mount path inside the container
+	Source   string // Path within From (bind/cache)
+	From     string // Stage or image to mount from
+	ID       string // Cache, secret or ssh id
+	Sharing  string // Cache sharing mode: shared, private or locked
+	ReadOnly bool   // Mounted read-only
+	Required bool   // Secret/ssh must be provided
+	Env      string // Secret exposed as environment variable
+}
+
+// parseRunInstruction extracts command, form and flags from a RUN instruction
+// Known variables in the command are expanded; the flags are evaluated like Docker does
+func parseRunInstruction(node *parser.Node, s *scope) RunInstruction {
+	run := RunInstruction{Location: nodeLocation(node)}
+
+	for _, flag := range node.Flags {
+		name, value, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		value = s.expand(value).Expanded
+
+		switch name {
+		case "mount":
+			if mount, ok := parseMount(value); ok {
+				run.Mounts = append(run.Mounts, mount)
+			}
+		case "network":
+			run.Network = value
+		case "security":
+			run.Security = value
+		}
+	}
+
+	// buildkit tells us if it's JSON via node.Attributes["json"]
+	if node.Attributes != nil && node.Attributes["json"] {
+		run.Exec = true
+		for n := node.Next; n != nil; n = n.Next {
+			run.Args = append(run.Args, n.Value)
+		}
+	}
+
+	run.Command = s.expandShell(reconstructCommand(node.Next))
+	if !run.Exec && len(node.Heredocs) == 0 {
+		run.Commands = splitCommands(run.Command)
+	}
+
+	for _, h := range node.Heredocs {
+		run.Heredocs = append(run.Heredocs, newHeredoc(h, s))
+	}
+
+	return run
+}
+
+// newHeredoc converts a buildkit heredoc, expanding its body unless the delimiter was quoted
+func newHeredoc(h parser.Heredoc, s *scope) Heredoc {
+	raw := h.Content
+	// buildkit flags <<- but leaves the leading tabs in place
+	if h.Chomp {
+		lines := strings.Split(raw, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimLeft(line, "\t")
+		}
+		raw = strings.Join(lines, "\n")
+	}
+
+	content := Word{Raw: raw, Expanded: raw}
+	if h.Expand {
+		content = s.expandShell(raw)
+	}
+
+	return Heredoc{
+		Name:    h.Name,
+		Content: content,
+		Expand:  h.Expand,
+		Chomp:   h.Chomp,
+	}
+}
+
+// parseMount parses the comma-separated key=value list of a --mount flag
+func parseMount(value string) (Mount, bool) {
+	fields, err := csv.NewReader(strings.NewReader(value)).Read()
+	if err != nil {
+		return Mount{}, false
+	}
+
+	mount := Mount{Type: "bind"}
+	for _, field := range fields {
+		key, val, hasValue := strings.Cut(field, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		switch key {
+		case "type":
+			mount.Type = strings.ToLower(val)
+		case "target", "dst", "destination":
+			mount.Target = val
+		case "source", "src":
+			mount.Source = val
+		case "from":
+			mount.From = val
+		case "id":
+			mount.ID = val
+		case "sharing":
+			mount.Sharing = val
+		case "env":
+			mount.Env = val
+		case "ro", "readonly":
+			mount.ReadOnly = !hasValue || val == "true"
+		case "rw", "readwrite":
+			mount.ReadOnly = hasValue && val != "true"
+		case "required":
+			mount.Required = !hasValue || val == "true"
+		}
+	}
+
+	// Apply the same defaults as buildkit
+	switch mount.Type {
+	case "cache":
+		if mount.ID == "" {
+			mount.ID = mount.Target
+		}
+		if mount.Sharing == "" {
+			mount.Sharing = "shared"
+		}
+	case "secret":
+		if mount.ID == "" && mount.Target != "" {
+			mount.ID = path.Base(mount.Target)
+		}
+		if mount.Target == "" && mount.Env == "" && mount.ID != "" {
+			mount.Target = "/run/secrets/" + mount.ID
+		}
+	case "ssh":
+		if mount.ID == "" {
+			mount.ID = "default"
+		}
+	}
+
+	return mount, true
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+/*
+Shell Decomposition:
+====================
+
+Shell-form RUN commands are parsed with a real shell parser (mvdan.cc/sh)
+and split into simple commands at the list operators &&, || and ;.
+Pipelines, subshells and compound commands (if, for, ...) stay whole.
+
+Example:
+  RUN apt-get update && apt-get install -y make && make build
+  Commands:
+    {Op: "",   Args: [apt-get update]}
+    {Op: "&&", Args: [apt-get install -y make]}
+    {Op: "&&", Args: [make build]}
+*/
+
+// ShellCommand is one command of a shell-form RUN list
+type ShellCommand struct {
+	Op   string   // Operator joining it to the previous command: "&&", "||", ";" or "" for the first
+	Args []string // Words of a simple command after quote removal, nil for compound commands
+	Text Word     // Command as written in the Dockerfile
+}
+
+// splitCommands decomposes a shell-form RUN command into its list of commands
+// Returns nil if the script cannot be parsed; raw and expanded forms are split
+// separately and paired, falling back to the expanded text if they disagree
+func splitCommands(cmd Word) []ShellCommand {
+	expanded, ok := parseShellList(cmd.Expanded)
+	if !ok {
+		return nil
+	}
+
+	raw, ok := parseShellList(cmd.Raw)
+	if !ok || len(raw) != len(expanded) {
+		raw = expanded
+	}
+
+	for i := range expanded {
+		expanded[i].Text.Raw = raw[i].Text.Expanded
+	}
+	return expanded
+}
+
+// parseShellList parses a script into its top-level list of commands
+// Bash syntax is accepted since many Dockerfiles set SHELL to bash
+func parseShellList(script string) ([]ShellCommand, bool) {
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(script), "")
+	if err != nil {
+		return nil, false
+	}
+
+	var commands []ShellCommand
+	var walk func(stmt *syntax.Stmt, op string)
+	walk = func(stmt *syntax.Stmt, op string) {
+		if bin, ok := stmt.Cmd.(*syntax.BinaryCmd); ok && !stmt.Negated && !stmt.Background &&
+			len(stmt.Redirs) == 0 && (bin.Op == syntax.AndStmt || bin.Op == syntax.OrStmt) {
+			walk(bin.X, op)
+			walk(bin.Y, bin.Op.String())
+			return
+		}
+
+		text := script[stmt.Pos().Offset():stmt.End().Offset()]
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), ";"))
+		command := ShellCommand{Op: op, Text: Word{Raw: text, Expanded: text}}
+		if call, ok := stmt.Cmd.(*syntax.CallExpr); ok && !stmt.Negated {
+			for _, word := range call.Args {
+				command.Args = append(command.Args, wordText(script, word))
+			}
+		}
+		commands = append(commands, command)
+	}
+
+	for i, stmt := range file.Stmts {
+		op := ";"
+		if i == 0 {
+			op = ""
+		}
+		walk(stmt, op)
+	}
+
+	return commands, true
+}
+
+// wordText returns a shell word with its quotes removed
+// Words containing expansions ($VAR, $(cmd), globs) are returned as written
+func wordText(script string, word *syntax.Word) string {
+	var b strings.Builder
+	for _, part := range word.Parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			b.WriteString(part.Value)
+		case *syntax.SglQuoted:
+			b.WriteString(part.Value)
+		case *syntax.DblQuoted:
+			for _, inner := range part.Parts {
+				lit, ok := inner.(*syntax.Lit)
+				if !ok {
+					return script[word.Pos().Offset():word.End().Offset()]
+				}
+				b.WriteString(lit.Value)
+			}
+		default:
+			return script[word.Pos().Offset():word.End().Offset()]
+		}
+	}
+	return b.String()
+}
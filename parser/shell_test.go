@@ -0,0 +1,240 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseShellList(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []ShellCommand
+	}{
+		{
+			name:   "simple command",
+			script: "make build",
+			want: []ShellCommand{
+				{Op: "", Args: []string{"make", "build"}, Text: word("make build")},
+			},
+		},
+		{
+			name:   "and list",
+			script: "apt-get update && apt-get install -y make && make build",
+			want: []ShellCommand{
+				{Op: "", Args: []string{"apt-get", "update"}, Text: word("apt-get update")},
+				{Op: "&&", Args: []string{"apt-get", "install", "-y", "make"}, Text: word("apt-get install -y make")},
+				{Op: "&&", Args: []string{"make", "build"}, Text: word("make build")},
+			},
+		},
+		{
+			name:   "or fallback",
+			script: "make test || true",
+			want: []ShellCommand{
+				{Op: "", Args: []string{"make", "test"}, Text: word("make test")},
+				{Op: "||", Args: []string{"true"}, Text: word("true")},
+			},
+		},
+		{
+			name:   "semicolons",
+			script: "cd /src; make; ",
+			want: []ShellCommand{
+				{Op: "", Args: []string{"cd", "/src"}, Text: word("cd /src")},
+				{Op: ";", Args: []string{"make"}, Text: word("make")},
+			},
+		},
+		{
+			name:   "mixed operators",
+			script: "cd /src && make || echo failed; ls",
+			want: []ShellCommand{
+				{Op: "", Args: []string{"cd", "/src"}, Text: word("cd /src")},
+				{Op: "&&", Args: []string{"make"}, Text: word("make")},
+				{Op: "||", Args: []string{"echo", "failed"}, Text: word("echo failed")},
+				{Op: ";", Args: []string{"ls"}, Text: word("ls")},
+			},
+		},
+		{
+			name:   "quotes removed from args",
+			script: `go build -ldflags "-s -w" -o 'bin/app' ./cmd`,
+			want: []ShellCommand{
+				{Op: "", Args: []string{"go", "build", "-ldflags", "-s -w", "-o", "bin/app", "./cmd"},
+					Text: word(`go build -ldflags "-s -w" -o 'bin/app' ./cmd`)},
+			},
+		},
+		{
+			name:   "expansions kept as written",
+			script: `go build -o "$OUT/app" $(go env GOPATH)`,
+			want: []ShellCommand{
+				{Op: "", Args: []string{"go", "build", "-o", `"$OUT/app"`, "$(go env GOPATH)"},
+					Text: word(`go build -o "$OUT/app" $(go env GOPATH)`)},
+			},
+		},
+		{
+			name:   "subshell stays whole",
+			script: "(cd web && npm ci) && make",
+			want: []ShellCommand{
+				{Op: "", Text: word("(cd web && npm ci)")},
+				{Op: "&&", Args: []string{"make"}, Text: word("make")},
+			},
+		},
+		{
+			name:   "pipeline stays whole",
+			script: "curl -sSL https://example.com/install.sh | sh && make",
+			want: []ShellCommand{
+				{Op: "", Text: word("curl -sSL https://example.com/install.sh | sh")},
+				{Op: "&&", Args: []string{"make"}, Text: word("make")},
+			},
+		},
+		{
+			name:   "if stays whole",
+			script: "if [ -f go.mod ]; then go build ./...; fi && ls",
+			want: []ShellCommand{
+				{Op: "", Text: word("if [ -f go.mod ]; then go build ./...; fi")},
+				{Op: "&&", Args: []string{"ls"}, Text: word("ls")},
+			},
+		},
+		{
+			name:   "negated command stays whole",
+			script: "! grep -q debug config && make",
+			want: []ShellCommand{
+				{Op: "", Text: word("! grep -q debug config")},
+				{Op: "&&", Args: []string{"make"}, Text: word("make")},
+			},
+		},
+		{
+			name:   "line continuations",
+			script: "apt-get update \\\n    && apt-get install -y \\\n       gcc \\\n    && make",
+			want: []ShellCommand{
+				{Op: "", Args: []string{"apt-get", "update"}, Text: word("apt-get update")},
+				{Op: "&&", Args: []string{"apt-get", "install", "-y", "gcc"}, Text: word("apt-get install -y \\\n       gcc")},
+				{Op: "&&", Args: []string{"make"}, Text: word("make")},
+			},
+		},
+		{
+			name:   "bash syntax",
+			script: "[[ -d vendor ]] && go build -mod=vendor",
+			want: []ShellCommand{
+				{Op: "", Text: word("[[ -d vendor ]]")},
+				{Op: "&&", Args: []string{"go", "build", "-mod=vendor"}, Text: word("go build -mod=vendor")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseShellList(tt.script)
+			if !ok {
+				t.Fatalf("parseShellList(%q) failed", tt.script)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseShellList(%q)\n got %+v\nwant %+v", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseShellListInvalid(t *testing.T) {
+	for _, script := range []string{"make && ", "echo 'unterminated", "if true; then make"} {
+		if got, ok := parseShellList(script); ok {
+			t.Errorf("parseShellList(%q) = %+v, want failure", script, got)
+		}
+	}
+}
+
+func TestSplitCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  Word
+		want []Word
+	}{
+		{
+			name: "raw and expanded are paired",
+			cmd:  Word{Raw: "cd $SRC && go build -o $OUT", Expanded: "cd /src && go build -o /out"},
+			want: []Word{
+				{Raw: "cd $SRC", Expanded: "cd /src"},
+				{Raw: "go build -o $OUT", Expanded: "go build -o /out"},
+			},
+		},
+		{
+			name: "expansion changes the list",
+			cmd:  Word{Raw: "make $TARGETS", Expanded: "make a && make b"},
+			want: []Word{
+				{Raw: "make a", Expanded: "make a"},
+				{Raw: "make b", Expanded: "make b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands := splitCommands(tt.cmd)
+			var got []Word
+			for _, c := range commands {
+				got = append(got, c.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCommands(%+v) = %+v, want %+v", tt.cmd, got, tt.want)
+			}
+		})
+	}
+
+	if got := splitCommands(Word{Raw: "make &&", Expanded: "make &&"}); got != nil {
+		t.Errorf("splitCommands of an invalid script = %+v, want nil", got)
+	}
+}
+
+func TestRunCommandsFromDockerfile(t *testing.T) {
+	info := parseTestDockerfile(t, `FROM golang:1.22
+ARG OUT=/out
+RUN apt-get update && \
+    apt-get install -y make \
+    && go build -o ${OUT}/app ./cmd
+RUN ["go", "test", "./..."]
+RUN <<EOF
+set -e
+make build
+EOF
+RUN bash <<EOF
+make install
+EOF
+`)
+
+	runs := info.Stages[0].Runs
+	if len(runs) != 4 {
+		t.Fatalf("got %d RUN instructions, want 4", len(runs))
+	}
+
+	// Shell form with continuation lines
+	var texts []string
+	for _, c := range runs[0].Commands {
+		texts = append(texts, c.Op+" "+c.Text.Expanded)
+	}
+	want := []string{" apt-get update", "&& apt-get install -y make", "&& go build -o /out/app ./cmd"}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("commands = %q, want %q", texts, want)
+	}
+	if raw := runs[0].Commands[2].Text.Raw; raw != "go build -o ${OUT}/app ./cmd" {
+		t.Errorf("raw command = %q", raw)
+	}
+
+	// Exec form and heredoc-fed RUNs are not split
+	for i, run := range runs[1:] {
+		if run.Commands != nil {
+			t.Errorf("RUN %d: Commands = %+v, want nil", i+2, run.Commands)
+		}
+	}
+	if !runs[1].Exec {
+		t.Errorf("RUN 2 is not exec form")
+	}
+	for i, run := range runs[2:] {
+		if len(run.Heredocs) != 1 || !strings.Contains(run.Heredocs[0].Content.Expanded, "make") {
+			t.Errorf("RUN %d: heredocs = %+v", i+3, run.Heredocs)
+		}
+	}
+}
+
+// word is a Word whose raw and expanded forms are equal
+func word(s string) Word {
+	return Word{Raw: s, Expanded: s}
+}
@@ -0,0 +1,104 @@
+package toolchain
+
+import (
+	"regexp"
+	"strings"
+
+	"dalec-mapping/parser"
+)
+
+// Toolchain is a language toolchain provided by a base image
+type Toolchain struct {
+	Name    string // Toolchain name: go, rust, node, python, java
+	Package string // Dalec dependency that provides it, e.g. msft-golang
+	Version string // Version from the image tag, e.g. 1.22, "" if unknown
+}
+
+// Constraint returns the Dalec version constraint, e.g. ">= 1.22", or "" if the version is unknown
+func (t Toolchain) Constraint() string {
+	if t.Version == "" {
+		return ""
+	}
+	return ">= " + t.Version
+}
+
+// Rule maps image repositories to a toolchain
+type Rule struct {
+	Repositories []string // Repository paths, e.g. golang or oss/go/microsoft/golang
+	Toolchain    string   // Toolchain name
+	Package      string   // Dalec dependency; "{major}" is replaced by the major version
+}
+
+// Table holds the rules used to detect toolchains from base images
+type Table struct {
+	rules []Rule
+}
+
+// Builtin returns a table with the well-known language images
+func Builtin() *Table {
+	t := &Table{}
+	t.Add(Rule{Repositories: []string{"golang", "oss/go/microsoft/golang"}, Toolchain: "go", Package: "msft-golang"})
+	t.Add(Rule{Repositories: []string{"rust"}, Toolchain: "rust", Package: "rust"})
+	t.Add(Rule{Repositories: []string{"node"}, Toolchain: "node", Package: "nodejs"})
+	t.Add(Rule{Repositories: []string{"python"}, Toolchain: "python", Package: "python3"})
+	t.Add(Rule{Repositories: []string{"eclipse-temurin", "openjdk/jdk"}, Toolchain: "java", Package: "msopenjdk-{major}"})
+	return t
+}
+
+// Add registers a rule; rules added later take precedence over earlier ones
+func (t *Table) Add(rule Rule) {
+	t.rules = append(t.rules, rule)
+}
+
+// Detect finds the toolchain provided by an image
+// Repositories match exactly, or by their last component for mirrors (myregistry/mirror/golang)
+func (t *Table) Detect(image parser.ImageRef) (Toolchain, bool) {
+	if t == nil || image.Repository == "" {
+		return Toolchain{}, false
+	}
+
+	for i := len(t.rules) - 1; i >= 0; i-- {
+		rule := t.rules[i]
+		if !matches(rule, image) {
+			continue
+		}
+
+		version := tagVersion(image.Tag)
+		pkg := rule.Package
+		if strings.Contains(pkg, "{major}") {
+			major, _, _ := strings.Cut(version, ".")
+			if major == "" {
+				// The version is part of the package name, there is nothing to guess it from
+				continue
+			}
+			pkg = strings.ReplaceAll(pkg, "{major}", major)
+			version = ""
+		}
+
+		return Toolchain{Name: rule.Toolchain, Package: pkg, Version: version}, true
+	}
+
+	return Toolchain{}, false
+}
+
+// matches reports whether a rule applies to an image
+func matches(rule Rule, image parser.ImageRef) bool {
+	for _, repo := range rule.Repositories {
+		if image.Repository == repo || image.Name() == repo {
+			return true
+		}
+	}
+	return false
+}
+
+// versionPrefix matches the leading version of a tag: 1.22.3-bookworm gives 1.22.3
+var versionPrefix = regexp.MustCompile(`^v?(\d+(\.\d+)*)`)
+
+// tagVersion extracts the toolchain version from an image tag, "" for tags like latest or alpine
+func tagVersion(tag string) string {
+	m := versionPrefix.FindStringSubmatch(tag)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
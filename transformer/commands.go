@@ -0,0 +1,210 @@
+package transformer
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	"dalec-mapping/parser"
+)
+
+// commandKind classifies one command of a RUN list (see parser.ShellCommand)
+type commandKind int
+
+const (
+	commandOther    commandKind = iota // Anything else, kept in build steps
+	commandBuild                       // Compiler or build tool: go build, make, cargo, ...
+	commandChdir                       // cd, kept so later commands run in the right directory
+	commandPackages                    // OS package manager, handled by dependencies instead
+	commandCleanup                     // Package manager cache cleanup, e.g. rm -rf /var/lib/apt/lists/*
+)
+
+// packageManagers are the OS package managers whose invocations are not build steps
+var packageManagers = map[string]bool{
+	"apt-get":  true,
+	"apt":      true,
+	"dpkg":     true,
+	"tdnf":     true,
+	"dnf":      true,
+	"microdnf": true,
+	"yum":      true,
+	"rpm":      true,
+	"apk":      true,
+}
+
+// buildTools are commands that compile or package the project
+var buildTools = map[string]bool{
+	"go":      true,
+	"make":    true,
+	"cmake":   true,
+	"ninja":   true,
+	"cargo":   true,
+	"npm":     true,
+	"yarn":    true,
+	"pnpm":    true,
+	"pip":     true,
+	"pip3":    true,
+	"python":  true,
+	"python3": true,
+	"mvn":     true,
+	"gradle":  true,
+	"gcc":     true,
+	"dotnet":  true,
+}
+
+// packageCacheDirs are removed after package installs to keep image layers small
+var packageCacheDirs = []string{
+	"/var/lib/apt/lists",
+	"/var/cache/apt",
+	"/var/cache/apk",
+	"/var/cache/yum",
+	"/var/cache/dnf",
+	"/var/cache/tdnf",
+}
+
+// classifyCommand decides what a single RUN command does
+func classifyCommand(cmd parser.ShellCommand) commandKind {
+	name, args := commandName(cmd)
+	switch {
+	case name == "":
+		return commandOther
+	case packageManagers[name]:
+		return commandPackages
+	case name == "cd":
+		return commandChdir
+	case name == "rm" && removesPackageCache(args):
+		return commandCleanup
+	case buildTools[name]:
+		return commandBuild
+	}
+	return commandOther
+}
+
+// commandName returns the program a command runs (without sudo or its directory) and its arguments
+func commandName(cmd parser.ShellCommand) (string, []string) {
+	args := cmd.Args
+	if len(args) > 0 && args[0] == "sudo" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return "", nil
+	}
+	return path.Base(args[0]), args[1:]
+}
+
+// removesPackageCache reports whether rm only deletes package manager caches
+func removesPackageCache(args []string) bool {
+	found := false
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		inCache := false
+		for _, dir := range packageCacheDirs {
+			if arg == dir || strings.HasPrefix(arg, dir+"/") {
+				inCache = true
+				break
+			}
+		}
+		if !inCache {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// runScript returns the build-relevant part of a RUN instruction and the
+// package manager commands that were left out. Each dropped command takes its
+// operator with it, as does an "|| ..." fallback that belongs to it.
+func runScript(run parser.RunInstruction, available map[string]bool) (string, []parser.ShellCommand) {
+	commands := run.Commands
+	if commands == nil {
+		if len(run.Heredocs) > 0 {
+			return runCommand(run, available), nil
+		}
+		// Exec form or a script the shell parser rejected: classify it as a whole
+		args := run.Args
+		if !run.Exec {
+			args = strings.Fields(run.Command.Expanded)
+		}
+		commands = []parser.ShellCommand{{Args: args, Text: run.Command}}
+	}
+
+	var b strings.Builder
+	var dropped []parser.ShellCommand
+	skipFallback := false
+
+	for _, cmd := range commands {
+		if cmd.Op == "||" && skipFallback {
+			continue
+		}
+
+		switch classifyCommand(cmd) {
+		case commandPackages:
+			dropped = append(dropped, cmd)
+			skipFallback = true
+			continue
+		case commandCleanup:
+			skipFallback = true
+			continue
+		}
+		skipFallback = false
+
+		if b.Len() > 0 {
+			if cmd.Op == ";" {
+				b.WriteString("\n")
+			} else {
+				b.WriteString(" " + cmd.Op + " ")
+			}
+		}
+		b.WriteString(pickWord(cmd.Text, available))
+	}
+
+	return b.String(), dropped
+}
+
+// runsTool reports whether any RUN of the stage invokes tool with one of the subcommands
+// Scripts the shell parser rejected are searched for "tool subcommand" as text
+func runsTool(stage parser.Stage, tool string, subcommands ...string) bool {
+	for _, run := range stage.Runs {
+		if run.Commands == nil {
+			fields := strings.Fields(run.Command.Expanded)
+			for i := 0; i+1 < len(fields); i++ {
+				if path.Base(fields[i]) == tool && slices.Contains(subcommands, fields[i+1]) {
+					return true
+				}
+			}
+			continue
+		}
+
+		for _, cmd := range run.Commands {
+			name, args := commandName(cmd)
+			if name == tool && len(args) > 0 && slices.Contains(subcommands, args[0]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// buildToolNames lists the build tools a RUN list invokes, for diagnostics
+func buildToolNames(run parser.RunInstruction) []string {
+	var tools []string
+	seen := make(map[string]bool)
+	for _, cmd := range run.Commands {
+		if classifyCommand(cmd) != commandBuild {
+			continue
+		}
+		name, args := commandName(cmd)
+		// "go build" and "go test" are more telling than "go"
+		if name == "go" && len(args) > 0 {
+			name += " " + args[0]
+		}
+		if !seen[name] {
+			seen[name] = true
+			tools = append(tools, name)
+		}
+	}
+	return tools
+}
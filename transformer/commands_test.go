@@ -0,0 +1,149 @@
+package transformer
+
+import (
+	"strings"
+	"testing"
+
+	"dalec-mapping/parser"
+)
+
+func TestClassifyCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want commandKind
+	}{
+		{[]string{"apt-get", "install", "-y", "make"}, commandPackages},
+		{[]string{"sudo", "tdnf", "install", "gcc"}, commandPackages},
+		{[]string{"/sbin/apk", "add", "git"}, commandPackages},
+		{[]string{"rm", "-rf", "/var/lib/apt/lists/*"}, commandCleanup},
+		{[]string{"rm", "-rf", "/var/lib/apt/lists/*", "/tmp/build"}, commandOther},
+		{[]string{"rm", "-rf"}, commandOther},
+		{[]string{"cd", "/src"}, commandChdir},
+		{[]string{"go", "build", "./..."}, commandBuild},
+		{[]string{"/usr/bin/make"}, commandBuild},
+		{[]string{"echo", "hi"}, commandOther},
+		{nil, commandOther},
+	}
+
+	for _, tt := range tests {
+		if got := classifyCommand(parser.ShellCommand{Args: tt.args}); got != tt.want {
+			t.Errorf("classifyCommand(%q) = %d, want %d", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	tests := []struct {
+		name        string
+		dockerfile  string
+		wantScript  string
+		wantDropped int
+	}{
+		{
+			name:        "package installs dropped",
+			dockerfile:  "RUN apt-get update && apt-get install -y make && make build",
+			wantScript:  "make build",
+			wantDropped: 2,
+		},
+		{
+			name:        "cleanup dropped with its operator",
+			dockerfile:  "RUN make build && rm -rf /var/lib/apt/lists/*",
+			wantScript:  "make build",
+			wantDropped: 0,
+		},
+		{
+			name:        "fallback of a dropped command dropped",
+			dockerfile:  "RUN apk add --no-cache git || apk add git && go build ./...",
+			wantScript:  "go build ./...",
+			wantDropped: 1,
+		},
+		{
+			name:        "fallback of a kept command kept",
+			dockerfile:  "RUN make test || true",
+			wantScript:  "make test || true",
+			wantDropped: 0,
+		},
+		{
+			name:        "semicolons become lines",
+			dockerfile:  "RUN cd /src; make",
+			wantScript:  "cd /src\nmake",
+			wantDropped: 0,
+		},
+		{
+			name:        "subshell kept whole",
+			dockerfile:  "RUN (cd web && npm ci) && tdnf install -y nodejs",
+			wantScript:  "(cd web && npm ci)",
+			wantDropped: 1,
+		},
+		{
+			name:       "line continuations",
+			dockerfile: "RUN apt-get update \\\n    && apt-get install -y gcc \\\n    && go build \\\n       -o /out/app .",
+			// buildkit joins continuation lines before the shell parser sees them
+			wantScript:  "go build        -o /out/app .",
+			wantDropped: 2,
+		},
+		{
+			name:        "exec form classified as a whole",
+			dockerfile:  `RUN ["apt-get", "install", "-y", "make"]`,
+			wantScript:  "",
+			wantDropped: 1,
+		},
+		{
+			name:        "heredoc script kept",
+			dockerfile:  "RUN <<EOF\napt-get install -y make\nmake build\nEOF",
+			wantScript:  "apt-get install -y make\nmake build",
+			wantDropped: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := parseDockerfile(t, "FROM golang:1.22\n"+tt.dockerfile+"\n")
+			script, dropped := runScript(info.Stages[0].Runs[0], nil)
+			if script != tt.wantScript {
+				t.Errorf("script = %q, want %q", script, tt.wantScript)
+			}
+			if len(dropped) != tt.wantDropped {
+				t.Errorf("dropped %d commands (%+v), want %d", len(dropped), dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestBuildStepsPerRun(t *testing.T) {
+	spec, diags := transform(t, &RepoMetadata{RepoName: "app"}, `FROM golang:1.22 AS build
+WORKDIR /src
+RUN cd tools && make gen
+RUN go build -o /out/app .
+WORKDIR other
+RUN make other
+
+FROM mcr.microsoft.com/azurelinux/base/core:3.0
+COPY --from=build /out/app /usr/bin/app
+`)
+
+	steps, _ := spec["build"].(map[string]interface{})["steps"].([]map[string]interface{})
+	want := []string{
+		"cd /src\ncd tools && make gen",
+		"cd /src\ngo build -o /out/app .",
+		"cd /src/other\nmake other",
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("steps = %v, want %d", steps, len(want))
+	}
+	for i := range want {
+		if steps[i]["command"] != want[i] {
+			t.Errorf("step %d = %q, want %q", i+1, steps[i]["command"], want[i])
+		}
+	}
+
+	var numbered []string
+	for _, d := range diags.Items() {
+		if strings.HasPrefix(d.Message, "build step ") {
+			numbered = append(numbered, strings.Fields(d.Message)[2])
+		}
+	}
+	if strings.Join(numbered, ",") != "1,2,3" {
+		t.Errorf("build step diagnostics numbered %v, want 1,2,3", numbered)
+	}
+}
@@ -0,0 +1,103 @@
+package transformer
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Spec Comments:
+==============
+
+The map IR has no place for comments, so they are kept under keys starting
+with "# " (like the "# syntax" header) that WriteYAML turns into YAML comments:
+
+  "# header"   comment lines written below the # syntax line (provenance)
+  "# comments" line comments attached to a key path
+
+  spec.TODO("add the SPDX license identifier", "license")
+
+becomes
+
+  license: "" # TODO(dalec-mapping): add the SPDX license identifier
+
+Comments are presentation only; they are not part of the typed Spec.
+*/
+
+const (
+	syntaxKey   = "# syntax"
+	headerKey   = "# header"
+	commentsKey = "# comments"
+)
+
+// todoPrefix marks fields that need manual input, so they are easy to grep for
+const todoPrefix = "TODO(dalec-mapping): "
+
+// specComment is a line comment on the key at Path
+type specComment struct {
+	Path []string
+	Text string
+}
+
+// Comment attaches a line comment to the key at path, e.g. ("sources", "app", "git", "url")
+// Comments on keys that are not in the written spec are ignored
+func (spec DalecSpec) Comment(text string, path ...string) {
+	comments, _ := spec[commentsKey].([]specComment)
+	spec[commentsKey] = append(comments, specComment{Path: path, Text: text})
+}
+
+// TODO marks the key at path as needing manual input
+func (spec DalecSpec) TODO(text string, path ...string) {
+	spec.Comment(todoPrefix+text, path...)
+}
+
+// Header adds a comment line to the top of the spec, below the # syntax line
+func (spec DalecSpec) Header(line string) {
+	header, _ := spec[headerKey].([]string)
+	spec[headerKey] = append(header, line)
+}
+
+// isCommentKey reports whether a key holds writer metadata rather than a spec field
+func isCommentKey(key string) bool {
+	return strings.HasPrefix(key, "# ")
+}
+
+// applyComments attaches the comments to the nodes of the encoded spec
+func applyComments(root *yaml.Node, comments []specComment) {
+	for _, c := range comments {
+		key, value := findKey(root, c.Path)
+		if key == nil {
+			continue
+		}
+
+		// Scalars and empty maps ({}) are written on the key's line, so the
+		// comment goes after the value; a block collection starts on the next line
+		text := "# " + c.Text
+		if value.Kind == yaml.ScalarNode || len(value.Content) == 0 {
+			value.LineComment = text
+		} else {
+			key.LineComment = text
+		}
+	}
+}
+
+// findKey walks nested mapping nodes along path and returns the last key and its value
+func findKey(node *yaml.Node, path []string) (key, value *yaml.Node) {
+	for _, name := range path {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return nil, nil
+		}
+
+		key, value = nil, nil
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == name {
+				key, value = node.Content[i], node.Content[i+1]
+				break
+			}
+		}
+		node = value
+	}
+
+	return key, value
+}
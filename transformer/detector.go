@@ -0,0 +1,159 @@
+package transformer
+
+import (
+	"os"
+	"path/filepath"
+
+	"dalec-mapping/diagnostics"
+	"dalec-mapping/parser"
+	"dalec-mapping/toolchain"
+)
+
+/*
+Language Detectors:
+===================
+
+A Detector recognises one kind of build (Go, Rust, Node.js, Python, ...) in
+the Dockerfile and contributes the language-specific parts of the spec:
+source generators, build env, dependencies, build steps and artifacts.
+
+Built-in detectors are registered for Go, Rust, Node.js and Python. In-house
+detectors are added with RegisterDetector, typically from an init function:
+
+  func init() {
+      transformer.RegisterDetector(myDetector{})
+  }
+*/
+
+// Detector recognises a language build and contributes to the Dalec spec
+type Detector interface {
+	// Name identifies the detector, e.g. "go"
+	Name() string
+
+	// Detect reports whether a reachable stage builds a project of this kind
+	// ctx.Stages is empty while detecting
+	Detect(stage parser.Stage, ctx DetectContext) bool
+
+	// Contribute returns the spec parts for the stages Detect matched
+	Contribute(ctx DetectContext) Contribution
+}
+
+// RepoFiles gives detectors read access to the repository being packaged
+type RepoFiles interface {
+	HasFile(name string) bool
+	ReadFile(name string) ([]byte, error)
+}
+
+// DirFiles is a RepoFiles backed by a local checkout
+type DirFiles string
+
+// HasFile reports whether the file exists relative to the checkout directory
+func (dir DirFiles) HasFile(name string) bool {
+	_, err := os.Stat(filepath.Join(string(dir), name))
+	return err == nil
+}
+
+// ReadFile reads a file relative to the checkout directory
+func (dir DirFiles) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(dir), name))
+}
+
+// DetectContext is the input of Detector.Detect and Detector.Contribute
+type DetectContext struct {
+	Info        *parser.DockerfileInfo
+	Stages      []parser.Stage // Reachable stages the detector matched, in Dockerfile order
+	PackageName string
+	Repo        RepoFiles        // May be nil
+	Toolchains  *toolchain.Table // Base image toolchains (Options.Toolchains)
+	Diags       *diagnostics.Collector
+
+	roles stageRoles
+}
+
+// Contribution is what a detector adds to the spec
+// Maps are merged into the matching spec section; existing entries are kept
+type Contribution struct {
+	Generators []map[string]interface{}                     // sources.<main source>.generate entries, e.g. {gomod: {}}
+	Env        map[string]string                            // build.env defaults, the Dockerfile's ENV wins
+	Build      map[string]interface{}                       // dependencies.build
+	Runtime    map[string]interface{}                       // dependencies.runtime
+	Targets    map[string]map[string]map[string]interface{} // targets.<target>.dependencies.<kind>
+	Steps      []map[string]interface{}                     // build.steps after the RUN commands
+	Artifacts  map[string]map[string]interface{}            // artifacts.<kind>, e.g. libexec
+}
+
+// detectors are consulted in registration order
+var detectors = []Detector{
+	goDetector{},
+	rustDetector{},
+	nodeDetector{},
+	pythonDetector{},
+}
+
+// RegisterDetector adds a detector after the built-in ones
+func RegisterDetector(d Detector) {
+	detectors = append(detectors, d)
+}
+
+// Detectors returns the registered detectors
+func Detectors() []Detector {
+	return append([]Detector{}, detectors...)
+}
+
+// runDetectors asks every detector about the reachable stages and collects the contributions
+func runDetectors(info *parser.DockerfileInfo, packageName string, opts Options, diags *diagnostics.Collector) []Contribution {
+	var contributions []Contribution
+	base := DetectContext{
+		Info:        info,
+		PackageName: packageName,
+		Repo:        opts.Repo,
+		Toolchains:  opts.Toolchains,
+		Diags:       diags,
+		roles:       rolesOf(info),
+	}
+
+	for _, d := range detectors {
+		var matched []parser.Stage
+		for _, stage := range info.ReachableStages() {
+			if d.Detect(stage, base) {
+				matched = append(matched, stage)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		diags.Infof(at(info, matched[0].Location), "detected %s build in stage %q", d.Name(), stageLabel(matched[0]))
+		ctx := base
+		ctx.Stages = matched
+		contributions = append(contributions, d.Contribute(ctx))
+	}
+
+	return contributions
+}
+
+// repoToolchain reports whether the repository has file (go.mod, Cargo.toml, ...) and the
+// stage's base image provides the named toolchain, for builds hidden behind make or scripts
+func repoToolchain(stage parser.Stage, ctx DetectContext, file, name string) bool {
+	if ctx.Repo == nil || !ctx.Repo.HasFile(file) {
+		return false
+	}
+	toolchains := ctx.Toolchains
+	if toolchains == nil {
+		toolchains = toolchain.Builtin()
+	}
+	tc, ok := toolchains.Detect(stage.Image)
+	return ok && tc.Name == name
+}
+
+// mergeDeps copies dependencies into deps, keeping entries that are already there
+// Like addToolchain, a versioned entry replaces an unversioned one
+func mergeDeps(deps map[string]interface{}, add map[string]interface{}) {
+	for name, constraint := range add {
+		existing, ok := deps[name].(map[string]interface{})
+		if c, _ := constraint.(map[string]interface{}); ok && (len(existing) > 0 || len(c) == 0) {
+			continue
+		}
+		deps[name] = constraint
+	}
+}
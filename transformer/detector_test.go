@@ -0,0 +1,71 @@
+package transformer
+
+import (
+	"testing"
+
+	"dalec-mapping/toolchain"
+)
+
+func TestDetectorsUseConfiguredToolchains(t *testing.T) {
+	dockerfile := `FROM registry.example.com/myorg/gobuilder:1.22 AS build
+RUN make build
+
+FROM mcr.microsoft.com/azurelinux/base/core:3.0
+COPY --from=build /src/bin/app /usr/bin/app
+`
+	repo := mapFiles{"go.mod": "module example.com/app\n"}
+
+	custom := toolchain.Builtin()
+	custom.Add(toolchain.Rule{Repositories: []string{"myorg/gobuilder"}, Toolchain: "go", Package: "msft-golang"})
+
+	tests := []struct {
+		name       string
+		toolchains *toolchain.Table
+		want       bool
+	}{
+		{"builtin table", nil, false},
+		{"custom rule", custom, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := parseDockerfile(t, dockerfile)
+			spec, _ := TransformToDalec(&RepoMetadata{RepoName: "app"}, PreviousDalecSpec{}, info, Options{Repo: repo, Toolchains: tt.toolchains})
+
+			source := spec["sources"].(map[string]interface{})["app"].(map[string]interface{})
+			generate, _ := source["generate"].([]map[string]interface{})
+			got := hasGenerator(generate, map[string]interface{}{"gomod": map[string]interface{}{}})
+			if got != tt.want {
+				t.Errorf("gomod generator = %v, want %v (generate: %v)", got, tt.want, source["generate"])
+			}
+		})
+	}
+}
+
+func TestDetectorEnvKeepsDockerfileEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want string
+	}{
+		{"detector default", "", "1"},
+		{"explicit ENV", "ENV CGO_ENABLED=0\n", "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, _ := transform(t, &RepoMetadata{RepoName: "app"}, "FROM golang:1.22 AS build\n"+tt.env+`RUN go build -o /out/app .
+
+FROM mcr.microsoft.com/azurelinux/base/core:3.0
+COPY --from=build /out/app /usr/bin/app
+`)
+			env := spec["build"].(map[string]interface{})["env"].(map[string]string)
+			if env["CGO_ENABLED"] != tt.want {
+				t.Errorf("CGO_ENABLED = %q, want %q", env["CGO_ENABLED"], tt.want)
+			}
+			if env["GOEXPERIMENT"] != "systemcrypto" {
+				t.Errorf("GOEXPERIMENT = %q, want the detector default", env["GOEXPERIMENT"])
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package transformer
+
+import (
+	"dalec-mapping/parser"
+)
+
+// goDetector handles Go builds: go build / go mod in a stage, or a go.mod in
+// the repository built on a golang image
+type goDetector struct{}
+
+func (goDetector) Name() string {
+	return "go"
+}
+
+func (goDetector) Detect(stage parser.Stage, ctx DetectContext) bool {
+	return hasGoModules(stage) || repoToolchain(stage, ctx, "go.mod", "go")
+}
+
+func (goDetector) Contribute(ctx DetectContext) Contribution {
+	c := Contribution{
+		Build: map[string]interface{}{
+			"msft-golang": map[string]interface{}{},
+		},
+		// Go binaries built with systemcrypto need the crypto libraries at runtime
+		Targets: map[string]map[string]map[string]interface{}{
+			"azlinux3": {
+				"runtime": {
+					"openssl-libs":     map[string]interface{}{},
+					"SymCrypt":         map[string]interface{}{},
+					"SymCrypt-OpenSSL": map[string]interface{}{},
+				},
+			},
+		},
+	}
+
+	if len(builderMatches(ctx)) > 0 {
+		c.Generators = []map[string]interface{}{
+			{"gomod": map[string]interface{}{}},
+		}
+		c.Env = map[string]string{
+			"GOPROXY":      "direct",
+			"GOEXPERIMENT": "systemcrypto",
+			"CGO_ENABLED":  "1",
+		}
+	}
+
+	return c
+}
+
+// hasGoModules reports whether a stage runs go build or go mod
+func hasGoModules(stage parser.Stage) bool {
+	return runsTool(stage, "go", "build", "mod")
+}
+
+// builderMatches returns the matched stages that are builder stages
+func builderMatches(ctx DetectContext) []parser.Stage {
+	var stages []parser.Stage
+	for _, stage := range ctx.Stages {
+		if ctx.roles.isBuilder(stage.Index) {
+			stages = append(stages, stage)
+		}
+	}
+	return stages
+}
@@ -0,0 +1,118 @@
+package transformer
+
+import (
+	"path"
+	"strings"
+
+	"dalec-mapping/diagnostics"
+	"dalec-mapping/parser"
+)
+
+// inlineFile is a file created by a COPY/ADD heredoc
+type inlineFile struct {
+	SourceName string // Name of the generated Dalec inline source
+	Content    string // File contents
+	Dest       string // Destination path in the image
+	Final      bool   // Copied into a runtime stage (see runtimeStages)
+	Location   parser.Location
+}
+
+// runCommand renders a RUN instruction as a shell command, inlining heredoc bodies
+// A bare "RUN <<EOF" becomes the script itself; "RUN python3 <<EOF" keeps the heredoc
+func runCommand(run parser.RunInstruction, available map[string]bool) string {
+	cmd := pickWord(run.Command, available)
+	if len(run.Heredocs) == 0 {
+		return cmd
+	}
+
+	if len(run.Heredocs) == 1 && isHeredocMarker(run.Command.Raw, run.Heredocs[0].Name) {
+		return strings.TrimSuffix(pickWord(run.Heredocs[0].Content, available), "\n")
+	}
+
+	var b strings.Builder
+	b.WriteString(cmd)
+	for _, h := range run.Heredocs {
+		b.WriteString("\n")
+		b.WriteString(pickWord(h.Content, available))
+		b.WriteString(h.Name)
+	}
+	return b.String()
+}
+
+// isHeredocMarker reports whether cmd is only the heredoc marker: <<EOF, <<-EOF, <<'EOF', <<"EOF"
+func isHeredocMarker(cmd, name string) bool {
+	marker := strings.TrimPrefix(strings.TrimSpace(cmd), "<<")
+	marker = strings.TrimPrefix(marker, "-")
+	marker = strings.Trim(marker, `"'`)
+	return marker == name
+}
+
+// collectInlineFiles finds COPY/ADD heredocs and names a Dalec inline source for each
+// Names already in used (other sources) are avoided
+func collectInlineFiles(info *parser.DockerfileInfo, used map[string]bool) []inlineFile {
+	var files []inlineFile
+	roles := rolesOf(info)
+
+	for _, stage := range info.ReachableStages() {
+		for _, copy := range stage.Copies {
+			for _, h := range copy.Heredocs {
+				dest := copy.Dest.Expanded
+				// A directory destination keeps the heredoc name as file name
+				if strings.HasSuffix(dest, "/") || len(copy.Heredocs) > 1 {
+					dest = path.Join(dest, strings.ToLower(h.Name))
+				}
+				if !path.IsAbs(dest) && stage.Workdir.Expanded != "" {
+					dest = path.Join(stage.Workdir.Expanded, dest)
+				}
+
+				files = append(files, inlineFile{
+					SourceName: uniqueSourceName(path.Base(dest), used),
+					Content:    h.Content.Expanded,
+					Dest:       dest,
+					Final:      roles.isRuntime(stage.Index),
+					Location:   copy.Location,
+				})
+			}
+		}
+	}
+
+	return files
+}
+
+// inlineSource creates a Dalec inline file source
+func inlineSource(file inlineFile) map[string]interface{} {
+	return map[string]interface{}{
+		"inline": map[string]interface{}{
+			"file": map[string]interface{}{
+				"contents": file.Content,
+			},
+		},
+	}
+}
+
+// configFileArtifacts installs inline files copied under /etc in the final image
+func configFileArtifacts(info *parser.DockerfileInfo, files []inlineFile, diags *diagnostics.Collector) map[string]interface{} {
+	configFiles := make(map[string]interface{})
+
+	for _, file := range files {
+		if !file.Final {
+			continue
+		}
+
+		if !strings.HasPrefix(file.Dest, "/etc/") {
+			diags.Warnf(at(info, file.Location), "could not translate inline file %s outside /etc, it needs a manual artifact mapping", file.Dest)
+			continue
+		}
+
+		artifact := map[string]interface{}{}
+		if subpath := strings.TrimPrefix(path.Dir(file.Dest), "/etc"); subpath != "" {
+			artifact["subpath"] = strings.TrimPrefix(subpath, "/")
+		}
+		if name := path.Base(file.Dest); name != file.SourceName {
+			artifact["name"] = name
+		}
+		configFiles[file.SourceName] = artifact
+	}
+
+	return configFiles
+}
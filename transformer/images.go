@@ -0,0 +1,90 @@
+package transformer
+
+import (
+	"path"
+	"strings"
+
+	"dalec-mapping/diagnostics"
+	"dalec-mapping/parser"
+)
+
+// imageFile is a path copied out of an external image with COPY --from=<image>
+type imageFile struct {
+	SourceName string // Name of the generated Dalec image source
+	Image      string // Image reference, e.g. golang:1.22
+	Path       string // Path inside the image
+	Dest       string // Destination in the Dockerfile stage
+	Final      bool   // Copied into a runtime stage (see runtimeStages)
+	Location   parser.Location
+}
+
+// collectImageFiles finds COPY --from=<image> sources in the reachable stages
+// Names already in used (other sources) are avoided
+func collectImageFiles(info *parser.DockerfileInfo, used map[string]bool) []imageFile {
+	var files []imageFile
+	roles := rolesOf(info)
+
+	for _, stage := range info.ReachableStages() {
+		for _, copy := range stage.Copies {
+			if copy.FromImage == "" {
+				continue
+			}
+
+			for _, src := range copy.Source {
+				files = append(files, imageFile{
+					SourceName: uniqueSourceName(imageSourceName(copy.FromImage, src.Expanded), used),
+					Image:      copy.FromImage,
+					Path:       src.Expanded,
+					Dest:       copy.Dest.Expanded,
+					Final:      roles.isRuntime(stage.Index),
+					Location:   copy.Location,
+				})
+			}
+		}
+	}
+
+	return files
+}
+
+// imageSource creates a Dalec source that extracts a path from a container image
+func imageSource(file imageFile) map[string]interface{} {
+	return map[string]interface{}{
+		"image": map[string]interface{}{
+			"ref": file.Image,
+		},
+		"path": file.Path,
+	}
+}
+
+// warnImageFiles explains how files from external images have to be wired up,
+// since Dalec only makes them available as sources in the build directory
+func warnImageFiles(info *parser.DockerfileInfo, files []imageFile, diags *diagnostics.Collector) {
+	for _, file := range files {
+		if file.Final {
+			diags.Warnf(at(info, file.Location), "%s from image %s is copied into the image at %s; source %q needs a manual artifact mapping",
+				file.Path, file.Image, file.Dest, file.SourceName)
+		} else {
+			diags.Warnf(at(info, file.Location), "%s from image %s is used by the build at %s; it is available as source %q (consider a build dependency instead)",
+				file.Path, file.Image, file.Dest, file.SourceName)
+		}
+	}
+}
+
+// imageSourceName derives a source name from the image repository and copied path
+// Example: golang:1.22 + /usr/local/go gives "golang-go"
+func imageSourceName(image, srcPath string) string {
+	repo := image
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo = repo[:i]
+	}
+	repo = path.Base(repo)
+	if i := strings.Index(repo, ":"); i >= 0 {
+		repo = repo[:i]
+	}
+
+	name := strings.Trim(path.Base(srcPath), "/.")
+	if name == "" || name == repo {
+		return repo
+	}
+	return repo + "-" + name
+}
@@ -0,0 +1,257 @@
+package transformer
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"dalec-mapping/diagnostics"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Three-Way Merge:
+================
+
+Regenerating a spec must not throw away what was edited by hand. Three
+versions of the spec take part:
+
+  base       what the tool generated last time (the .generated sidecar
+             next to -output, see ReadBaseline)
+  edited     the previous spec as it is now (-spec), possibly edited by hand
+  generated  the fresh generation
+
+Each key is merged on its own, recursing into maps:
+
+  edited == base         not touched by hand, the generated value wins
+  generated == base      edited by hand only, the edit stays
+  edited == generated    same change on both sides
+  otherwise              conflict: the edit stays, marked with a
+                         # CONFLICT(dalec-mapping): comment and reported
+
+Lists (build steps, tests, generators) are merged as a whole. Without a
+baseline every key that differs between edited and generated is a conflict,
+keys only one side has are kept.
+
+The release bookkeeping in args (COMMIT, VERSION, REVISION) is owned by the
+tool: it is always taken from the fresh generation, which already accounts
+for the previous values (see rebuild), and never reported as a conflict.
+*/
+
+// conflictPrefix marks fields that were edited by hand and regenerated differently
+const conflictPrefix = "CONFLICT(dalec-mapping): "
+
+// toolOwned are the fields the merge always takes from the fresh generation
+var toolOwned = [][]string{
+	{"args", "COMMIT"},
+	{"args", "VERSION"},
+	{"args", "REVISION"},
+}
+
+// Conflict is a field that was edited by hand and generated differently
+type Conflict struct {
+	Path      []string
+	Edited    interface{} // Kept in the output, nil if the key was deleted by hand
+	Generated interface{} // Nil if the key is no longer generated
+}
+
+// MergePrevious merges the fresh generation with the previous spec so hand edits are kept
+// Conflicts are marked in the returned spec and reported as warnings
+func MergePrevious(previous PreviousDalecSpec, generated DalecSpec, diags *diagnostics.Collector) DalecSpec {
+	if previous.Spec == nil {
+		return generated
+	}
+	if previous.Baseline == nil {
+		diags.Warnf(diagnostics.Position{File: previous.Path}, "no baseline %s from the last generation, every difference to the previous spec is treated as a conflict",
+			previous.baselineFile())
+	}
+
+	merged, conflicts := mergeSpecs(previous.Baseline, previous.Spec, generated)
+
+	for _, c := range conflicts {
+		pos := diagnostics.Position{File: previous.Path}
+		if key, _ := findKey(previous.root(), c.Path); key != nil {
+			pos.StartLine = key.Line
+		}
+		diags.Warnf(pos, "merge conflict at %s: kept the edited value %s, generated %s",
+			strings.Join(c.Path, "."), formatValue(c.Edited), formatValue(c.Generated))
+	}
+
+	return merged
+}
+
+// mergeSpecs merges the three versions of a spec; base may be nil
+func mergeSpecs(base, edited, generated DalecSpec) (DalecSpec, []Conflict) {
+	var conflicts []Conflict
+	fields := mergeMaps(nil, normalize(base), normalize(edited), normalize(generated), &conflicts)
+
+	merged := DalecSpec(fields)
+
+	// The syntax line and provenance header always come from the fresh generation
+	for _, key := range []string{syntaxKey, headerKey} {
+		if v, ok := generated[key]; ok {
+			merged[key] = v
+		}
+	}
+
+	// Generated comments (TODOs) only apply where the generated value was kept
+	comments, _ := generated[commentsKey].([]specComment)
+	for _, c := range comments {
+		if kept, ok := lookupPath(fields, c.Path); ok && reflect.DeepEqual(kept, lookupValue(normalize(generated), c.Path)) {
+			merged.Comment(c.Text, c.Path...)
+		}
+	}
+
+	for _, c := range conflicts {
+		merged.Comment(conflictPrefix+"generated "+formatValue(c.Generated), c.Path...)
+	}
+
+	return merged, conflicts
+}
+
+// mergeMaps merges one level of the spec
+func mergeMaps(path []string, base, edited, generated map[string]interface{}, conflicts *[]Conflict) map[string]interface{} {
+	result := make(map[string]interface{})
+
+	for _, key := range unionKeys(base, edited, generated) {
+		b, inBase := base[key]
+		e, inEdited := edited[key]
+		g, inGenerated := generated[key]
+		keyPath := append(append([]string{}, path...), key)
+
+		switch {
+		case isToolOwned(keyPath):
+			if inGenerated {
+				result[key] = g
+			}
+
+		case same(e, inEdited, b, inBase):
+			// Not touched by hand: the fresh generation wins
+			if inGenerated {
+				result[key] = g
+			}
+
+		case same(g, inGenerated, b, inBase), same(e, inEdited, g, inGenerated):
+			// Edited by hand only, or the same change on both sides
+			if inEdited {
+				result[key] = e
+			}
+
+		default:
+			em, editedMap := e.(map[string]interface{})
+			gm, generatedMap := g.(map[string]interface{})
+			if editedMap && generatedMap {
+				bm, _ := b.(map[string]interface{})
+				result[key] = mergeMaps(keyPath, bm, em, gm, conflicts)
+				continue
+			}
+
+			// Real conflict: keep the hand edit
+			*conflicts = append(*conflicts, Conflict{Path: keyPath, Edited: e, Generated: g})
+			if inEdited {
+				result[key] = e
+			}
+		}
+	}
+
+	return result
+}
+
+// isToolOwned reports whether the field at path is always regenerated
+func isToolOwned(path []string) bool {
+	for _, owned := range toolOwned {
+		if reflect.DeepEqual(path, owned) {
+			return true
+		}
+	}
+	return false
+}
+
+// same reports whether two optional values are equal; two missing values are equal
+func same(a interface{}, aOK bool, b interface{}, bOK bool) bool {
+	if aOK != bOK {
+		return false
+	}
+	return !aOK || reflect.DeepEqual(a, b)
+}
+
+// unionKeys returns the keys of all maps in order
+func unionKeys(maps ...map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalize converts a spec to the plain YAML types (map[string]interface{},
+// []interface{}, string, ...), so generated and loaded values compare equal
+func normalize(spec DalecSpec) map[string]interface{} {
+	if spec == nil {
+		return nil
+	}
+
+	fields := make(map[string]interface{})
+	for k, v := range spec {
+		if !isCommentKey(k) {
+			fields[k] = v
+		}
+	}
+
+	data, err := yaml.Marshal(fields)
+	if err != nil {
+		return fields
+	}
+	normalized := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &normalized); err != nil {
+		return fields
+	}
+	return normalized
+}
+
+// lookupPath returns the value at path in nested maps
+func lookupPath(m map[string]interface{}, path []string) (interface{}, bool) {
+	var value interface{} = m
+	for _, key := range path {
+		node, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = node[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// lookupValue is lookupPath without the presence flag
+func lookupValue(m map[string]interface{}, path []string) interface{} {
+	value, _ := lookupPath(m, path)
+	return value
+}
+
+// formatValue renders a value on one line for comments and reports
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "(none)"
+	case string:
+		return fmt.Sprintf("%q", v)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
@@ -0,0 +1,50 @@
+package transformer
+
+import (
+	"testing"
+)
+
+func TestMergeTakesBookkeepingArgsFromGeneration(t *testing.T) {
+	edited := DalecSpec{
+		"name":    "app",
+		"license": "MIT",
+		"args":    map[string]interface{}{"COMMIT": "old", "VERSION": "1.0.0", "REVISION": "3", "EXTRA": "kept"},
+	}
+	generated := DalecSpec{
+		"name":    "app",
+		"license": "Apache-2.0",
+		"args":    map[string]interface{}{"COMMIT": "new", "VERSION": "1.1.0", "REVISION": "1"},
+	}
+
+	tests := []struct {
+		name          string
+		base          DalecSpec
+		wantConflicts int
+	}{
+		{"without baseline", nil, 1}, // only license
+		{"with baseline", DalecSpec{
+			"name":    "app",
+			"license": "",
+			"args":    map[string]interface{}{"COMMIT": "older", "VERSION": "0.9.0", "REVISION": "1"},
+		}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflicts := mergeSpecs(tt.base, edited, generated)
+
+			args := merged["args"].(map[string]interface{})
+			for key, want := range map[string]string{"COMMIT": "new", "VERSION": "1.1.0", "REVISION": "1", "EXTRA": "kept"} {
+				if args[key] != want {
+					t.Errorf("args.%s = %v, want %s", key, args[key], want)
+				}
+			}
+			if merged["license"] != "MIT" {
+				t.Errorf("license = %v, want the edited MIT", merged["license"])
+			}
+			if len(conflicts) != tt.wantConflicts {
+				t.Errorf("conflicts = %+v, want %d", conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
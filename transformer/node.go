@@ -0,0 +1,107 @@
+package transformer
+
+import (
+	"path"
+	"strings"
+
+	"dalec-mapping/diagnostics"
+	"dalec-mapping/parser"
+)
+
+// nodeDetector handles Node.js builds with npm, yarn or pnpm
+type nodeDetector struct{}
+
+func (nodeDetector) Name() string {
+	return "node"
+}
+
+func (nodeDetector) Detect(stage parser.Stage, ctx DetectContext) bool {
+	return hasNodeBuild(stage) || repoToolchain(stage, ctx, "package.json", "node")
+}
+
+func (nodeDetector) Contribute(ctx DetectContext) Contribution {
+	// The nodejs package ships npm as well
+	c := Contribution{
+		Build: map[string]interface{}{
+			"nodejs": map[string]interface{}{},
+		},
+		Artifacts: make(map[string]map[string]interface{}),
+	}
+
+	// Dalec's node-mod generator fetches node_modules ahead of the build
+	if len(builderMatches(ctx)) > 0 {
+		c.Generators = []map[string]interface{}{
+			{"nodemod": map[string]interface{}{}},
+		}
+	}
+
+	// Node builds produce directories (dist/, node_modules/) rather than binaries
+	libexec, dataDirs := nodeArtifacts(ctx.Info, ctx.PackageName, ctx.Diags)
+	if len(libexec) > 0 {
+		c.Artifacts["libexec"] = libexec
+	}
+	if len(dataDirs) > 0 {
+		c.Artifacts["dataDirs"] = dataDirs
+	}
+
+	return c
+}
+
+// hasNodeBuild reports whether a stage installs Node.js dependencies with npm, yarn or pnpm
+func hasNodeBuild(stage parser.Stage) bool {
+	return runsTool(stage, "npm", "ci", "install") ||
+		runsTool(stage, "yarn", "install") ||
+		runsTool(stage, "pnpm", "install")
+}
+
+// isNodeStage reports whether the stage at index, or a stage it is built FROM, is a Node build
+// Builds often install dependencies in one stage and run "npm run build" in another FROM it
+func isNodeStage(info *parser.DockerfileInfo, index int) bool {
+	for index >= 0 {
+		stage := info.Stages[index]
+		if hasNodeBuild(stage) {
+			return true
+		}
+		index = stage.BaseStage
+	}
+	return false
+}
+
+// nodeArtifacts maps files copied out of Node builder stages into the image
+// (dist/, build/, node_modules/, ...): anything under /usr/share becomes a data
+// dir, everything else is installed under /usr/libexec/<package>
+func nodeArtifacts(info *parser.DockerfileInfo, packageName string, diags *diagnostics.Collector) (libexec, dataDirs map[string]interface{}) {
+	libexec = make(map[string]interface{})
+	dataDirs = make(map[string]interface{})
+
+	roles := rolesOf(info)
+	for _, stage := range runtimeStages(info) {
+		for _, copy := range stage.Copies {
+			if !roles.copiesFromBuilder(copy) || !isNodeStage(info, copy.FromStage) {
+				continue
+			}
+
+			for _, src := range copy.Source {
+				if isBinaryPath(src.Expanded) {
+					continue
+				}
+
+				dest := copy.Dest.Expanded
+				if !path.IsAbs(dest) && stage.Workdir.Expanded != "" {
+					dest = path.Join(stage.Workdir.Expanded, dest)
+				}
+
+				if rel, ok := strings.CutPrefix(dest, "/usr/share/"); ok {
+					dataDirs[src.Expanded] = map[string]interface{}{"subpath": strings.TrimSuffix(rel, "/")}
+					diags.Infof(at(info, copy.Location), "artifacts.dataDirs %s", src.Expanded)
+					continue
+				}
+
+				libexec[src.Expanded] = map[string]interface{}{"subpath": packageName}
+				diags.Infof(at(info, copy.Location), "artifacts.libexec %s (was copied to %s)", src.Expanded, dest)
+			}
+		}
+	}
+
+	return libexec, dataDirs
+}
@@ -0,0 +1,199 @@
+package transformer
+
+import (
+	"dalec-mapping/diagnostics"
+	"dalec-mapping/mapping"
+	"dalec-mapping/parser"
+)
+
+// nativeManagers install packages under the names Dalec's rpm-based targets use,
+// so their packages need no mapping
+var nativeManagers = map[string]bool{
+	"tdnf":     true,
+	"dnf":      true,
+	"microdnf": true,
+	"yum":      true,
+}
+
+// installedPackage is a package installed by a RUN in a reachable stage
+type installedPackage struct {
+	Package  parser.Package
+	Manager  string // Package manager that installed it
+	Kind     string // "build" or "runtime" dependency
+	Location parser.Location
+}
+
+// packageDeps are the Dalec dependencies derived from package installs
+type packageDeps struct {
+	Common   map[string]map[string]interface{}            // kind → package → constraint, for all targets
+	Targets  map[string]map[string]map[string]interface{} // target → kind → package → constraint
+	Unmapped map[string]map[string]string                 // kind → package → package manager, kept as written
+}
+
+// packageHousekeeping are package manager subcommands that install nothing
+var packageHousekeeping = map[string]bool{
+	"update":     true,
+	"upgrade":    true,
+	"clean":      true,
+	"autoremove": true,
+	"autoclean":  true,
+	"makecache":  true,
+	"cache":      true,
+}
+
+// collectPackages finds the packages installed in the reachable stages
+// Packages installed in builder stages are needed to build,
+// packages installed in the image stages at runtime. The target stage of a
+// single-stage Dockerfile is both, so its packages are needed for both.
+func collectPackages(info *parser.DockerfileInfo) []installedPackage {
+	var packages []installedPackage
+	roles := rolesOf(info)
+
+	for _, stage := range info.ReachableStages() {
+		var kinds []string
+		if roles.isBuilder(stage.Index) {
+			kinds = append(kinds, "build")
+		}
+		if roles.isRuntime(stage.Index) {
+			kinds = append(kinds, "runtime")
+		}
+
+		for _, run := range stage.Runs {
+			for _, install := range run.PackageInstalls() {
+				for _, pkg := range install.Packages {
+					for _, kind := range kinds {
+						packages = append(packages, installedPackage{
+							Package:  pkg,
+							Manager:  install.Manager,
+							Kind:     kind,
+							Location: run.Location,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	return packages
+}
+
+// mapPackages translates installed packages to Dalec dependencies with the mapping table
+// Names that are the same on every target stay in the top-level dependencies,
+// translated names go to the target they were mapped for. Unmapped packages are
+// kept as written and reported for manual review.
+func mapPackages(info *parser.DockerfileInfo, packages []installedPackage, table *mapping.Table, diags *diagnostics.Collector) packageDeps {
+	deps := packageDeps{
+		Common:   make(map[string]map[string]interface{}),
+		Targets:  make(map[string]map[string]map[string]interface{}),
+		Unmapped: make(map[string]map[string]string),
+	}
+
+	for _, installed := range packages {
+		pkg := installed.Package
+		if nativeManagers[installed.Manager] {
+			addPackage(deps.common(installed.Kind), pkg)
+			continue
+		}
+
+		targets, ok := table.Lookup(pkg.Name)
+		if !ok {
+			addPackage(deps.common(installed.Kind), pkg)
+			if deps.Unmapped[installed.Kind] == nil {
+				deps.Unmapped[installed.Kind] = make(map[string]string)
+			}
+			deps.Unmapped[installed.Kind][pkg.Name] = installed.Manager
+			diags.Warnf(at(info, installed.Location), "no package mapping for %s package %q, check dependencies.%s.%s manually",
+				installed.Manager, pkg.Name, installed.Kind, pkg.Name)
+			continue
+		}
+
+		// Versions of the Dockerfile's distro do not carry over to the Dalec targets
+		if pkg.Version != "" {
+			diags.Infof(at(info, installed.Location), "dropped %s version pin %s%s of %q", installed.Manager, pkg.Op, pkg.Version, pkg.Name)
+		}
+
+		if sameOnAllTargets(pkg.Name, targets) {
+			addPackage(deps.common(installed.Kind), parser.Package{Name: pkg.Name})
+			continue
+		}
+
+		for target, names := range targets {
+			if len(names) == 0 {
+				diags.Infof(at(info, installed.Location), "%s package %q is not needed on %s", installed.Manager, pkg.Name, target)
+			}
+			for _, name := range names {
+				addPackage(deps.target(target, installed.Kind), parser.Package{Name: name})
+			}
+		}
+	}
+
+	return deps
+}
+
+// common returns the top-level dependencies of kind, creating the map on first use
+func (deps packageDeps) common(kind string) map[string]interface{} {
+	if deps.Common[kind] == nil {
+		deps.Common[kind] = make(map[string]interface{})
+	}
+	return deps.Common[kind]
+}
+
+// target returns the dependencies of kind for target, creating the maps on first use
+func (deps packageDeps) target(target, kind string) map[string]interface{} {
+	if deps.Targets[target] == nil {
+		deps.Targets[target] = make(map[string]map[string]interface{})
+	}
+	if deps.Targets[target][kind] == nil {
+		deps.Targets[target][kind] = make(map[string]interface{})
+	}
+	return deps.Targets[target][kind]
+}
+
+// sameOnAllTargets reports whether every target installs pkg under its own name
+func sameOnAllTargets(pkg string, targets map[string][]string) bool {
+	for _, names := range targets {
+		if len(names) != 1 || names[0] != pkg {
+			return false
+		}
+	}
+	return true
+}
+
+// addPackage records a package as a Dalec dependency
+// A version pin is kept over an unpinned request for the same package
+func addPackage(deps map[string]interface{}, pkg parser.Package) {
+	if existing, ok := deps[pkg.Name].(map[string]interface{}); ok && len(existing) > 0 && pkg.Version == "" {
+		return
+	}
+	deps[pkg.Name] = packageConstraint(pkg)
+}
+
+// packageConstraint converts a version pin to a Dalec dependency entry
+// Example: make=4.3-4 gives {version: ["= 4.3-4"]}
+func packageConstraint(pkg parser.Package) map[string]interface{} {
+	if pkg.Version == "" {
+		return map[string]interface{}{}
+	}
+
+	op := pkg.Op
+	// apk's fuzzy "~" match has no rpm equivalent, the closest is a lower bound
+	if op == "~" {
+		op = ">="
+	}
+	return map[string]interface{}{
+		"version": []string{op + " " + pkg.Version},
+	}
+}
+
+// isHousekeeping reports whether a package manager command only maintains the
+// package database (apt-get update, dnf clean all, ...) and can be dropped silently
+func isHousekeeping(cmd parser.ShellCommand) bool {
+	_, args := commandName(cmd)
+	for _, arg := range args {
+		if len(arg) > 0 && arg[0] == '-' {
+			continue
+		}
+		return packageHousekeeping[arg]
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package transformer
+
+import (
+	"testing"
+)
+
+func TestPackageDependencyKinds(t *testing.T) {
+	tests := []struct {
+		name        string
+		dockerfile  string
+		wantBuild   []string
+		wantRuntime []string
+	}{
+		{
+			name: "multi-stage",
+			dockerfile: `FROM mcr.microsoft.com/azurelinux/base/core:3.0 AS build
+RUN tdnf install -y make gcc
+RUN make
+
+FROM mcr.microsoft.com/azurelinux/base/core:3.0
+RUN tdnf install -y ca-certificates
+COPY --from=build /src/bin/app /usr/bin/app
+`,
+			wantBuild:   []string{"gcc", "make"},
+			wantRuntime: []string{"ca-certificates"},
+		},
+		{
+			name: "single-stage",
+			dockerfile: `FROM mcr.microsoft.com/azurelinux/base/core:3.0
+RUN tdnf install -y make ca-certificates
+RUN make
+`,
+			wantBuild:   []string{"ca-certificates", "make"},
+			wantRuntime: []string{"ca-certificates", "make"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, _ := transform(t, nil, tt.dockerfile)
+			deps := spec["dependencies"].(map[string]interface{})
+			checkKeys(t, "dependencies.build", deps["build"], tt.wantBuild)
+			checkKeys(t, "dependencies.runtime", deps["runtime"], tt.wantRuntime)
+		})
+	}
+}
+
+func TestTargetDependenciesIncludeCommon(t *testing.T) {
+	spec, _ := transform(t, nil, `FROM golang:1.22 AS build
+RUN apt-get update && apt-get install -y make libssl-dev
+RUN go build -o /out/app .
+
+FROM debian:12-slim
+RUN apt-get update && apt-get install -y ca-certificates
+COPY --from=build /out/app /usr/bin/app
+`)
+
+	deps := spec["dependencies"].(map[string]interface{})
+	checkKeys(t, "dependencies.build", deps["build"], []string{"make", "msft-golang"})
+	checkKeys(t, "dependencies.runtime", deps["runtime"], []string{"ca-certificates"})
+
+	target := spec["targets"].(map[string]interface{})["azlinux3"].(map[string]interface{})["dependencies"].(map[string]interface{})
+	checkKeys(t, "targets.azlinux3.dependencies.build", target["build"], []string{"make", "msft-golang", "openssl-devel"})
+	// The Go detector adds the FIPS crypto libraries on Azure Linux
+	checkKeys(t, "targets.azlinux3.dependencies.runtime", target["runtime"], []string{"SymCrypt", "SymCrypt-OpenSSL", "ca-certificates", "openssl-libs"})
+}
+
+func TestStageRoles(t *testing.T) {
+	info := parseDockerfile(t, `FROM golang:1.22 AS build
+RUN go build -o /out/app .
+
+FROM golang:1.22 AS test
+RUN go test ./...
+
+FROM mcr.microsoft.com/azurelinux/base/core:3.0 AS base
+FROM base
+COPY --from=build /out/app /usr/bin/app
+`)
+
+	roles := rolesOf(info)
+	for index, want := range map[int][2]bool{
+		0: {true, false},  // build
+		1: {false, false}, // test, not reachable
+		2: {false, true},  // base of the target
+		3: {false, true},  // target
+	} {
+		if got := [2]bool{roles.isBuilder(index), roles.isRuntime(index)}; got != want {
+			t.Errorf("stage %d: builder, runtime = %v, want %v", index, got, want)
+		}
+	}
+}
+
+// checkKeys compares the sorted keys of a spec map with want
+func checkKeys(t *testing.T, name string, section interface{}, want []string) {
+	t.Helper()
+
+	m, _ := section.(map[string]interface{})
+	got := sortedKeys(m)
+	if len(got) != len(want) {
+		t.Errorf("%s = %v, want %v", name, got, want)
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s = %v, want %v", name, got, want)
+			return
+		}
+	}
+}
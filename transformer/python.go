@@ -0,0 +1,303 @@
+package transformer
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"dalec-mapping/diagnostics"
+	"dalec-mapping/parser"
+)
+
+// pythonDetector handles Python builds with pip
+type pythonDetector struct{}
+
+func (pythonDetector) Name() string {
+	return "python"
+}
+
+func (pythonDetector) Detect(stage parser.Stage, ctx DetectContext) bool {
+	return hasPythonBuild(stage) ||
+		repoToolchain(stage, ctx, "requirements.txt", "python") ||
+		repoToolchain(stage, ctx, "pyproject.toml", "python")
+}
+
+func (pythonDetector) Contribute(ctx DetectContext) Contribution {
+	// pip is packaged separately from the interpreter
+	c := Contribution{
+		Build: map[string]interface{}{
+			"python3":     map[string]interface{}{},
+			"python3-pip": map[string]interface{}{},
+		},
+		Runtime: map[string]interface{}{
+			"python3": map[string]interface{}{},
+		},
+		Artifacts: make(map[string]map[string]interface{}),
+	}
+
+	// Dalec's pip generator downloads the requirements ahead of the build
+	if len(builderMatches(ctx)) > 0 {
+		c.Generators = []map[string]interface{}{
+			{"pip": map[string]interface{}{}},
+		}
+	}
+
+	for _, stage := range ctx.Stages {
+		if ctx.roles.isRuntime(stage.Index) && !ctx.roles.isBuilder(stage.Index) {
+			ctx.Diags.Warnf(at(ctx.Info, stage.Location), "stage %q runs pip in the image, move the install into a build step and map its files manually", stageLabel(stage))
+		}
+	}
+
+	// Python builds produce site-packages, virtualenvs and console scripts
+	libs, libexec := pythonArtifacts(ctx.Info, ctx.PackageName, ctx.Diags)
+	if len(libs) > 0 {
+		c.Artifacts["libs"] = libs
+	}
+	if len(libexec) > 0 {
+		c.Artifacts["libexec"] = libexec
+	}
+
+	// ENTRYPOINT ["myapp"] runs a console script that pip installed
+	if target := ctx.Info.TargetStage(); target != nil {
+		script := consoleScript(*target)
+		if script != "" && !hasBinaryNamed(builderBinaries(ctx.Info), script) &&
+			(declaresConsoleScript(ctx.Repo, script) || installsLocalProject(ctx.Stages)) {
+			if dir := scriptDir(builderMatches(ctx)); dir != "" {
+				src := path.Join(dir, script)
+				c.Artifacts["binaries"] = map[string]interface{}{src: map[string]interface{}{}}
+				ctx.Diags.Infof(at(ctx.Info, target.Location), "artifacts.binaries %s (console script entrypoint)", src)
+			} else {
+				ctx.Diags.Warnf(at(ctx.Info, target.Location), "the image runs console script %q, which pip installs next to the interpreter; add its path to artifacts.binaries manually", script)
+			}
+		}
+	}
+
+	return c
+}
+
+// hasPythonBuild reports whether a stage installs or builds Python packages with pip
+func hasPythonBuild(stage parser.Stage) bool {
+	if runsTool(stage, "pip", "install", "wheel") || runsTool(stage, "pip3", "install", "wheel") {
+		return true
+	}
+
+	// python -m pip install ...
+	for _, run := range stage.Runs {
+		for _, cmd := range run.Commands {
+			name, args := commandName(cmd)
+			if strings.HasPrefix(name, "python") && len(args) >= 3 && args[0] == "-m" && args[1] == "pip" &&
+				(args[2] == "install" || args[2] == "wheel") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isPythonStage reports whether the stage at index, or a stage it is built FROM, is a Python build
+func isPythonStage(info *parser.DockerfileInfo, index int) bool {
+	for index >= 0 {
+		stage := info.Stages[index]
+		if hasPythonBuild(stage) {
+			return true
+		}
+		index = stage.BaseStage
+	}
+	return false
+}
+
+// pythonArtifacts maps what Python builder stages produce for the image:
+// site-packages/dist-packages directories become libs under their lib/ path,
+// other directories (virtualenvs, install prefixes) are installed under /usr/libexec/<package>
+func pythonArtifacts(info *parser.DockerfileInfo, packageName string, diags *diagnostics.Collector) (libs, libexec map[string]interface{}) {
+	libs = make(map[string]interface{})
+	libexec = make(map[string]interface{})
+
+	roles := rolesOf(info)
+	for _, stage := range runtimeStages(info) {
+		for _, copy := range stage.Copies {
+			if !roles.copiesFromBuilder(copy) || !isPythonStage(info, copy.FromStage) {
+				continue
+			}
+
+			for _, src := range copy.Source {
+				if isBinaryPath(src.Expanded) {
+					continue
+				}
+
+				if isSitePackages(src.Expanded) {
+					subpath := src.Expanded
+					if i := strings.Index(copy.Dest.Expanded, "/lib/"); i >= 0 {
+						subpath = copy.Dest.Expanded[i+len("/lib/"):]
+					} else if i := strings.Index(subpath, "/lib/"); i >= 0 {
+						subpath = subpath[i+len("/lib/"):]
+					}
+					libs[src.Expanded] = map[string]interface{}{"subpath": strings.Trim(subpath, "/")}
+					diags.Infof(at(info, copy.Location), "artifacts.libs %s", src.Expanded)
+					continue
+				}
+
+				libexec[src.Expanded] = map[string]interface{}{"subpath": packageName}
+				diags.Infof(at(info, copy.Location), "artifacts.libexec %s (was copied to %s)", src.Expanded, copy.Dest.Expanded)
+			}
+		}
+	}
+
+	return libs, libexec
+}
+
+// isSitePackages reports whether a path is (inside) a Python site-packages directory
+func isSitePackages(p string) bool {
+	parts := strings.Split(p, "/")
+	return slices.Contains(parts, "site-packages") || slices.Contains(parts, "dist-packages")
+}
+
+// consoleScript returns the program an image runs if it could be a pip console
+// script: a bare command name that is not the interpreter or a shell. Whether it
+// is one is decided by declaresConsoleScript and installsLocalProject.
+func consoleScript(stage parser.Stage) string {
+	command := stage.Entrypoint
+	if len(command) == 0 {
+		command = stage.Cmd
+	}
+	// Shell form: /bin/sh -c "myapp --flag"
+	if len(command) == 3 && command[1] == "-c" {
+		command = strings.Fields(command[2])
+	}
+	if len(command) == 0 {
+		return ""
+	}
+
+	name := command[0]
+	if strings.Contains(name, "/") || strings.HasPrefix(name, "python") ||
+		name == "pip" || name == "sh" || name == "bash" || name == "gunicorn" || name == "uvicorn" {
+		return ""
+	}
+	return name
+}
+
+// scriptSections are the pyproject.toml and setup.cfg sections that declare console scripts
+var scriptSections = []string{"project.scripts", "tool.poetry.scripts", "options.entry_points"}
+
+// declaresConsoleScript reports whether the project's packaging metadata declares a
+// console script called name: [project.scripts] or [tool.poetry.scripts] in
+// pyproject.toml, console_scripts in setup.cfg or setup.py
+func declaresConsoleScript(repo RepoFiles, name string) bool {
+	if repo == nil {
+		return false
+	}
+
+	for _, file := range []string{"pyproject.toml", "setup.cfg"} {
+		if content, err := repo.ReadFile(file); err == nil && hasSectionKey(string(content), name, scriptSections) {
+			return true
+		}
+	}
+
+	// entry_points={"console_scripts": ["name = package.module:func"]}
+	if content, err := repo.ReadFile("setup.py"); err == nil {
+		entry := regexp.MustCompile(`["']\s*` + regexp.QuoteMeta(name) + `\s*=\s*[\w.]+:[\w.]+`)
+		return strings.Contains(string(content), "console_scripts") && entry.Match(content)
+	}
+	return false
+}
+
+// hasSectionKey reports whether an INI or TOML file has the key in one of the sections
+func hasSectionKey(content, key string, sections []string) bool {
+	section := ""
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			section = strings.Trim(line, "[] ")
+			continue
+		}
+		name, _, ok := strings.Cut(line, "=")
+		if ok && slices.Contains(sections, section) && strings.Trim(strings.TrimSpace(name), `"'`) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// installsLocalProject reports whether a stage installs the project being built
+// with pip (pip install ., pip install -e ./app, ...), which installs its console scripts
+func installsLocalProject(stages []parser.Stage) bool {
+	for _, stage := range stages {
+		for _, run := range stage.Runs {
+			for _, cmd := range run.Commands {
+				args := pipInstallArgs(cmd)
+				for i, arg := range args {
+					if i > 0 && (args[i-1] == "-r" || args[i-1] == "--requirement" || args[i-1] == "-c") {
+						continue
+					}
+					if arg == "." || strings.HasPrefix(arg, "./") {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// pipInstallArgs returns the arguments after "install" of a pip install command, nil for other commands
+func pipInstallArgs(cmd parser.ShellCommand) []string {
+	name, args := commandName(cmd)
+	if strings.HasPrefix(name, "python") && len(args) >= 2 && args[0] == "-m" && args[1] == "pip" {
+		name, args = "pip", args[2:]
+	}
+	if (name != "pip" && name != "pip3") || len(args) == 0 || args[0] != "install" {
+		return nil
+	}
+	return args[1:]
+}
+
+// scriptDir returns the bin directory pip installs console scripts into in the
+// builder stages: a virtualenv (python -m venv, ENV VIRTUAL_ENV) or a --prefix.
+// Returns "" if pip installs next to the interpreter, whose location depends on the image.
+func scriptDir(stages []parser.Stage) string {
+	for _, stage := range stages {
+		for _, run := range stage.Runs {
+			for _, cmd := range run.Commands {
+				name, args := commandName(cmd)
+				// python -m venv /opt/venv, virtualenv /opt/venv
+				if strings.HasPrefix(name, "python") && len(args) >= 3 && args[0] == "-m" && (args[1] == "venv" || args[1] == "virtualenv") {
+					if dir := lastOperand(args[2:]); dir != "" {
+						return path.Join(dir, "bin")
+					}
+				}
+				if name == "virtualenv" {
+					if dir := lastOperand(args); dir != "" {
+						return path.Join(dir, "bin")
+					}
+				}
+
+				// pip install --prefix=/install ...
+				install := pipInstallArgs(cmd)
+				for i, arg := range install {
+					if prefix, ok := strings.CutPrefix(arg, "--prefix="); ok {
+						return path.Join(prefix, "bin")
+					}
+					if arg == "--prefix" && i+1 < len(install) {
+						return path.Join(install[i+1], "bin")
+					}
+				}
+			}
+		}
+
+		if venv := stage.Env["VIRTUAL_ENV"].Expanded; venv != "" {
+			return path.Join(venv, "bin")
+		}
+	}
+	return ""
+}
+
+// lastOperand returns the last argument that is not a flag
+func lastOperand(args []string) string {
+	for i := len(args) - 1; i >= 0; i-- {
+		if !strings.HasPrefix(args[i], "-") {
+			return args[i]
+		}
+	}
+	return ""
+}
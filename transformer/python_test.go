@@ -0,0 +1,142 @@
+package transformer
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"dalec-mapping/diagnostics"
+)
+
+// mapFiles is an in-memory RepoFiles
+type mapFiles map[string]string
+
+func (m mapFiles) HasFile(name string) bool {
+	_, ok := m[name]
+	return ok
+}
+
+func (m mapFiles) ReadFile(name string) ([]byte, error) {
+	content, ok := m[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return []byte(content), nil
+}
+
+func TestPythonConsoleScript(t *testing.T) {
+	pyproject := mapFiles{"pyproject.toml": "[project]\nname = \"myapp\"\n\n[project.scripts]\nmyapp = \"myapp.cli:main\"\n"}
+
+	tests := []struct {
+		name       string
+		repo       RepoFiles
+		dockerfile string
+		want       string // Expected binary artifact, "" for none
+		wantWarn   bool   // Warning that the path has to be added manually
+	}{
+		{
+			name: "declared in pyproject, virtualenv",
+			repo: pyproject,
+			dockerfile: `FROM python:3.12 AS build
+RUN python -m venv /opt/venv
+RUN /opt/venv/bin/pip install -r requirements.txt
+FROM python:3.12-slim
+COPY --from=build /opt/venv /opt/venv
+ENTRYPOINT ["myapp"]
+`,
+			want: "/opt/venv/bin/myapp",
+		},
+		{
+			name: "local install with prefix",
+			dockerfile: `FROM python:3.12 AS build
+RUN pip install --prefix=/install .
+FROM python:3.12-slim
+COPY --from=build /install /usr/local
+CMD ["myapp", "--serve"]
+`,
+			want: "/install/bin/myapp",
+		},
+		{
+			name: "other entrypoint without evidence",
+			dockerfile: `FROM python:3.12 AS build
+ENV VIRTUAL_ENV=/opt/venv
+RUN pip install -r requirements.txt
+FROM python:3.12-slim
+COPY --from=build /opt/venv /opt/venv
+ENTRYPOINT ["tini", "--"]
+`,
+		},
+		{
+			name: "requirements file is no local install",
+			repo: pyproject,
+			dockerfile: `FROM python:3.12 AS build
+ENV VIRTUAL_ENV=/opt/venv
+RUN pip install -r ./requirements.txt
+FROM python:3.12-slim
+COPY --from=build /opt/venv /opt/venv
+ENTRYPOINT ["nginx"]
+`,
+		},
+		{
+			name: "installed next to the interpreter",
+			dockerfile: `FROM python:3.12
+RUN pip install .
+ENTRYPOINT ["myapp"]
+`,
+			wantWarn: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := parseDockerfile(t, tt.dockerfile)
+			spec, diags := TransformToDalec(&RepoMetadata{RepoName: "myapp"}, PreviousDalecSpec{}, info, Options{Repo: tt.repo})
+
+			binaries, _ := spec["artifacts"].(map[string]interface{})["binaries"].(map[string]interface{})
+			var got []string
+			for src := range binaries {
+				if strings.Contains(src, "/bin/") {
+					got = append(got, src)
+				}
+			}
+			switch {
+			case tt.want == "" && len(got) > 0:
+				t.Errorf("binaries = %v, want none", got)
+			case tt.want != "" && (len(got) != 1 || got[0] != tt.want):
+				t.Errorf("binaries = %v, want %s", got, tt.want)
+			}
+
+			warned := false
+			for _, d := range diags.Items() {
+				if d.Severity == diagnostics.Warning && strings.Contains(d.Message, "console script") {
+					warned = true
+				}
+			}
+			if warned != tt.wantWarn {
+				t.Errorf("console script warning = %v, want %v", warned, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestDeclaresConsoleScript(t *testing.T) {
+	tests := []struct {
+		name string
+		repo RepoFiles
+		want bool
+	}{
+		{"pyproject", mapFiles{"pyproject.toml": "[project.scripts]\nmyapp = \"myapp.cli:main\"\n"}, true},
+		{"poetry", mapFiles{"pyproject.toml": "[tool.poetry.scripts]\n\"myapp\" = \"myapp.cli:main\"\n"}, true},
+		{"pyproject other section", mapFiles{"pyproject.toml": "[project]\nmyapp = \"x\"\n"}, false},
+		{"setup.cfg", mapFiles{"setup.cfg": "[options.entry_points]\nconsole_scripts =\n    myapp = myapp.cli:main\n"}, true},
+		{"setup.py", mapFiles{"setup.py": "setup(entry_points={'console_scripts': ['myapp=myapp.cli:main']})"}, true},
+		{"setup.py other script", mapFiles{"setup.py": "setup(entry_points={'console_scripts': ['other=myapp.cli:main']})"}, false},
+		{"no repo", nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := declaresConsoleScript(tt.repo, "myapp"); got != tt.want {
+			t.Errorf("%s: declaresConsoleScript = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package transformer
+
+import (
+	"path"
+
+	"dalec-mapping/parser"
+)
+
+// rustDetector handles Rust builds with cargo
+type rustDetector struct{}
+
+func (rustDetector) Name() string {
+	return "rust"
+}
+
+func (rustDetector) Detect(stage parser.Stage, ctx DetectContext) bool {
+	return hasCargoBuild(stage) || repoToolchain(stage, ctx, "Cargo.toml", "rust")
+}
+
+func (rustDetector) Contribute(ctx DetectContext) Contribution {
+	// The rust package ships cargo as well
+	c := Contribution{
+		Build: map[string]interface{}{
+			"rust": map[string]interface{}{},
+		},
+	}
+
+	if builders := builderMatches(ctx); len(builders) > 0 {
+		// Dalec's cargo generator vendors the crates and points cargo at them,
+		// so CARGO_HOME is only kept when the Dockerfile sets it explicitly
+		c.Generators = []map[string]interface{}{
+			{"cargohome": map[string]interface{}{}},
+		}
+		if home := cargoHome(builders[0]); home != "" {
+			c.Env = map[string]string{"CARGO_HOME": home}
+		}
+	}
+
+	return c
+}
+
+// hasCargoBuild reports whether a stage builds a Rust project with cargo build or cargo install
+func hasCargoBuild(stage parser.Stage) bool {
+	return runsTool(stage, "cargo", "build", "install")
+}
+
+// cargoHome returns the CARGO_HOME the stage sets with ENV, "" if it sets none
+// (the rust image's /usr/local/cargo means nothing in a Dalec build)
+func cargoHome(stage parser.Stage) string {
+	return stage.Env["CARGO_HOME"].Expanded
+}
+
+// isCargoBinary reports whether a path is a cargo release build output:
+// target/release/<name> or target/<triple>/release/<name>
+func isCargoBinary(p string) bool {
+	dir := path.Dir(p)
+	if path.Base(dir) != "release" {
+		return false
+	}
+	dir = path.Dir(dir)
+	return path.Base(dir) == "target" || path.Base(path.Dir(dir)) == "target"
+}
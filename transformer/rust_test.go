@@ -0,0 +1,55 @@
+package transformer
+
+import (
+	"testing"
+)
+
+func TestRustCargoHome(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		want       string // "" if CARGO_HOME must not be set
+	}{
+		{
+			name: "rust image default left to the generator",
+			dockerfile: `FROM rust:1.79 AS build
+RUN cargo build --release
+
+FROM mcr.microsoft.com/azurelinux/base/core:3.0
+COPY --from=build /src/target/release/app /usr/bin/app
+`,
+		},
+		{
+			name: "explicit ENV kept",
+			dockerfile: `FROM rust:1.79 AS build
+ENV CARGO_HOME=/opt/cargo
+RUN cargo build --release
+
+FROM mcr.microsoft.com/azurelinux/base/core:3.0
+COPY --from=build /src/target/release/app /usr/bin/app
+`,
+			want: "/opt/cargo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, _ := transform(t, &RepoMetadata{RepoName: "app"}, tt.dockerfile)
+
+			env, _ := spec["build"].(map[string]interface{})["env"].(map[string]string)
+			home, ok := env["CARGO_HOME"]
+			switch {
+			case tt.want == "" && ok:
+				t.Errorf("CARGO_HOME = %v, want it unset", home)
+			case tt.want != "" && home != tt.want:
+				t.Errorf("CARGO_HOME = %v, want %s", home, tt.want)
+			}
+
+			source := spec["sources"].(map[string]interface{})["app"].(map[string]interface{})
+			generate, _ := source["generate"].([]map[string]interface{})
+			if !hasGenerator(generate, map[string]interface{}{"cargohome": map[string]interface{}{}}) {
+				t.Errorf("generate = %v, want the cargohome generator", source["generate"])
+			}
+		})
+	}
+}
@@ -0,0 +1,522 @@
+package transformer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Typed Spec Model:
+=================
+
+DalecSpec stays the working IR: the transformer builds it with map keys, and
+WriteYAML serializes it. Spec is the typed view of the same document with
+the fields Dalec accepts, used to validate the map before it is written:
+
+  spec := DalecSpec{...}          // built by TransformToDalec
+  typed, err := SpecFromMap(spec) // unknown keys, wrong shapes
+  err = typed.Validate()          // required fields, one-of sections
+  m, err := typed.ToMap()         // back to the map IR
+
+Conversion goes through YAML, so it is lossless for everything that is
+written out: top-level x-* extensions are kept in Spec.Extensions, only
+empty sections (e.g. targets: {}) and comments are dropped.
+*/
+
+// Spec is the typed Dalec spec
+type Spec struct {
+	Syntax string `yaml:"# syntax,omitempty"` // Frontend image, written as the # syntax= header
+
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description"`
+	Website     string            `yaml:"website"`
+	License     string            `yaml:"license"`
+	Vendor      string            `yaml:"vendor,omitempty"`
+	Packager    string            `yaml:"packager,omitempty"`
+	Version     string            `yaml:"version"`
+	Revision    string            `yaml:"revision"`
+	Args        map[string]string `yaml:"args,omitempty"`
+	NoArch      bool              `yaml:"noarch,omitempty"`
+
+	Provides  map[string]PackageConstraints `yaml:"provides,omitempty"`
+	Replaces  map[string]PackageConstraints `yaml:"replaces,omitempty"`
+	Conflicts map[string]PackageConstraints `yaml:"conflicts,omitempty"`
+	Changelog []ChangelogEntry              `yaml:"changelog,omitempty"`
+
+	Sources      map[string]Source      `yaml:"sources,omitempty"`
+	Patches      map[string][]PatchSpec `yaml:"patches,omitempty"`
+	Dependencies *Dependencies          `yaml:"dependencies,omitempty"`
+	Targets      map[string]Target      `yaml:"targets,omitempty"`
+	Build        *Build                 `yaml:"build,omitempty"`
+	Artifacts    *Artifacts             `yaml:"artifacts,omitempty"`
+	Image        *ImageConfig           `yaml:"image,omitempty"`
+	Tests        []TestSpec             `yaml:"tests"`
+
+	// Extensions holds the x-* keys (e.g. x-build-extensions), which Dalec ignores
+	Extensions map[string]interface{} `yaml:",inline"`
+}
+
+// Source is one entry of the sources section; exactly one of Git, HTTP, Image,
+// Inline, Context or Build is set
+type Source struct {
+	Git     *SourceGit     `yaml:"git,omitempty"`
+	HTTP    *SourceHTTP    `yaml:"http,omitempty"`
+	Image   *SourceImage   `yaml:"image,omitempty"`
+	Inline  *SourceInline  `yaml:"inline,omitempty"`
+	Context *SourceContext `yaml:"context,omitempty"`
+	Build   *SourceBuild   `yaml:"build,omitempty"`
+
+	Path     string            `yaml:"path,omitempty"`
+	Includes []string          `yaml:"includes,omitempty"`
+	Excludes []string          `yaml:"excludes,omitempty"`
+	Generate []SourceGenerator `yaml:"generate,omitempty"`
+}
+
+// SourceGit is a git repository source
+type SourceGit struct {
+	URL        string `yaml:"url"`
+	Commit     string `yaml:"commit"`
+	KeepGitDir bool   `yaml:"keepGitDir,omitempty"`
+}
+
+// SourceHTTP is a file downloaded over HTTP
+type SourceHTTP struct {
+	URL    string `yaml:"url"`
+	Digest string `yaml:"digest,omitempty"`
+}
+
+// SourceImage is a path taken from a container image, optionally after
+// running commands in it
+type SourceImage struct {
+	Ref string   `yaml:"ref"`
+	Cmd *Command `yaml:"cmd,omitempty"`
+}
+
+// Command runs steps in an image source
+type Command struct {
+	Dir       string              `yaml:"dir,omitempty"`
+	Mounts    []SourceMount       `yaml:"mounts,omitempty"`
+	CacheDirs map[string]CacheDir `yaml:"cache_dirs,omitempty"`
+	Env       map[string]string   `yaml:"env,omitempty"`
+	Steps     []BuildStep         `yaml:"steps,omitempty"`
+}
+
+// SourceMount mounts a source into a command
+type SourceMount struct {
+	Dest string `yaml:"dest"`
+	Spec Source `yaml:"spec"`
+}
+
+// SourceBuild is the output of a Dockerfile build
+type SourceBuild struct {
+	Source         Source            `yaml:"source"`
+	DockerfilePath string            `yaml:"dockerfile_path,omitempty"`
+	Target         string            `yaml:"target,omitempty"`
+	Args           map[string]string `yaml:"args,omitempty"`
+}
+
+// SourceInline is a file or directory written in the spec itself
+type SourceInline struct {
+	File *SourceInlineFile `yaml:"file,omitempty"`
+	Dir  *SourceInlineDir  `yaml:"dir,omitempty"`
+}
+
+// SourceInlineFile is the content of an inline file source
+type SourceInlineFile struct {
+	Contents    string `yaml:"contents"`
+	Permissions uint32 `yaml:"permissions,omitempty"`
+}
+
+// SourceInlineDir is an inline directory of files
+type SourceInlineDir struct {
+	Files map[string]SourceInlineFile `yaml:"files,omitempty"`
+}
+
+// SourceContext is the client's build context
+type SourceContext struct {
+	Name string `yaml:"name,omitempty"`
+}
+
+// SourceGenerator fetches language dependencies ahead of the build;
+// exactly one generator type is set
+type SourceGenerator struct {
+	Subpath   string     `yaml:"subpath,omitempty"`
+	Gomod     *Generator `yaml:"gomod,omitempty"`
+	Cargohome *Generator `yaml:"cargohome,omitempty"`
+	Nodemod   *Generator `yaml:"nodemod,omitempty"`
+	Pip       *Generator `yaml:"pip,omitempty"`
+}
+
+// Generator holds the options of a source generator
+type Generator struct {
+	Paths []string `yaml:"paths,omitempty"`
+}
+
+// PatchSpec applies a patch from a source to another source
+type PatchSpec struct {
+	Source string `yaml:"source"`
+	Path   string `yaml:"path,omitempty"`
+	Strip  *int   `yaml:"strip,omitempty"`
+}
+
+// ChangelogEntry is one entry of the package changelog
+type ChangelogEntry struct {
+	Date    string   `yaml:"date"`
+	Author  string   `yaml:"author"`
+	Changes []string `yaml:"changes"`
+}
+
+// Dependencies lists packages by the phase that needs them
+type Dependencies struct {
+	Build      map[string]PackageConstraints `yaml:"build,omitempty"`
+	Runtime    map[string]PackageConstraints `yaml:"runtime,omitempty"`
+	Recommends map[string]PackageConstraints `yaml:"recommends,omitempty"`
+	Test       map[string]PackageConstraints `yaml:"test,omitempty"`
+}
+
+// PackageConstraints restricts the versions and architectures of a dependency
+type PackageConstraints struct {
+	Version []string `yaml:"version,omitempty"`
+	Arch    []string `yaml:"arch,omitempty"`
+}
+
+// Target overrides the spec for one build target (e.g. azlinux3)
+type Target struct {
+	Dependencies  *Dependencies  `yaml:"dependencies,omitempty"`
+	Image         *ImageConfig   `yaml:"image,omitempty"`
+	Artifacts     *Artifacts     `yaml:"artifacts,omitempty"`
+	Tests         []TestSpec     `yaml:"tests,omitempty"`
+	PackageConfig *PackageConfig `yaml:"package_config,omitempty"`
+}
+
+// PackageConfig holds the packaging options of a target
+type PackageConfig struct {
+	Signer *PackageSigner `yaml:"signer,omitempty"`
+}
+
+// PackageSigner is the frontend that signs the built packages
+type PackageSigner struct {
+	Image   string            `yaml:"image"`
+	CmdPath string            `yaml:"cmdline,omitempty"`
+	Args    map[string]string `yaml:"args,omitempty"`
+}
+
+// Build holds the build environment and steps
+type Build struct {
+	Env         map[string]string `yaml:"env,omitempty"`
+	Caches      []CacheConfig     `yaml:"caches,omitempty"`
+	NetworkMode string            `yaml:"network_mode,omitempty"`
+	Steps       []BuildStep       `yaml:"steps,omitempty"`
+}
+
+// BuildStep is one shell script run during the build
+type BuildStep struct {
+	Command string            `yaml:"command"`
+	Env     map[string]string `yaml:"env,omitempty"`
+}
+
+// CacheConfig is a build cache; exactly one of Dir or GoBuild is set
+type CacheConfig struct {
+	Dir     *CacheDir     `yaml:"dir,omitempty"`
+	GoBuild *GoBuildCache `yaml:"gobuild,omitempty"`
+}
+
+// CacheDir is a persistent cache directory
+type CacheDir struct {
+	Key     string `yaml:"key"`
+	Dest    string `yaml:"dest"`
+	Sharing string `yaml:"sharing,omitempty"`
+}
+
+// GoBuildCache is Dalec's managed Go build cache
+type GoBuildCache struct {
+	Scope string `yaml:"scope,omitempty"`
+}
+
+// Artifacts lists the files the package installs, by kind
+type Artifacts struct {
+	Binaries    map[string]ArtifactConfig `yaml:"binaries,omitempty"`
+	Libexec     map[string]ArtifactConfig `yaml:"libexec,omitempty"`
+	Libs        map[string]ArtifactConfig `yaml:"libs,omitempty"`
+	DataDirs    map[string]ArtifactConfig `yaml:"dataDirs,omitempty"`
+	ConfigFiles map[string]ArtifactConfig `yaml:"configFiles,omitempty"`
+	Docs        map[string]ArtifactConfig `yaml:"docs,omitempty"`
+	Licenses    map[string]ArtifactConfig `yaml:"licenses,omitempty"`
+	Manpages    map[string]ArtifactConfig `yaml:"manpages,omitempty"`
+	Headers     map[string]ArtifactConfig `yaml:"headers,omitempty"`
+
+	Systemd     *SystemdConfig      `yaml:"systemd,omitempty"`
+	Links       []ArtifactLink      `yaml:"links,omitempty"`
+	Directories *ArtifactDirs       `yaml:"createDirectories,omitempty"`
+	Users       []ArtifactUserGroup `yaml:"users,omitempty"`
+	Groups      []ArtifactUserGroup `yaml:"groups,omitempty"`
+}
+
+// ArtifactConfig controls where an artifact is installed
+type ArtifactConfig struct {
+	SubPath     string `yaml:"subpath,omitempty"`
+	Name        string `yaml:"name,omitempty"`
+	Permissions uint32 `yaml:"permissions,omitempty"`
+	User        string `yaml:"user,omitempty"`
+	Group       string `yaml:"group,omitempty"`
+}
+
+// SystemdConfig lists the systemd units and drop-ins the package installs
+type SystemdConfig struct {
+	Units   map[string]SystemdUnit              `yaml:"units,omitempty"`
+	Dropins map[string]map[string]SystemdDropin `yaml:"dropins,omitempty"`
+}
+
+// SystemdUnit is a unit file and whether it is enabled and started
+type SystemdUnit struct {
+	Name   string `yaml:"name,omitempty"`
+	Enable bool   `yaml:"enable,omitempty"`
+	Start  bool   `yaml:"start,omitempty"`
+}
+
+// SystemdDropin is a drop-in file for a unit
+type SystemdDropin struct {
+	Name string `yaml:"name,omitempty"`
+}
+
+// ArtifactLink is a symlink created by the package
+type ArtifactLink struct {
+	Source string `yaml:"source"`
+	Dest   string `yaml:"dest"`
+	User   string `yaml:"user,omitempty"`
+	Group  string `yaml:"group,omitempty"`
+}
+
+// ArtifactDirs lists the empty directories the package creates
+type ArtifactDirs struct {
+	Config map[string]ArtifactDir `yaml:"config,omitempty"`
+	State  map[string]ArtifactDir `yaml:"state,omitempty"`
+}
+
+// ArtifactDir is the mode and owner of a created directory
+type ArtifactDir struct {
+	Mode  uint32 `yaml:"mode,omitempty"`
+	User  string `yaml:"user,omitempty"`
+	Group string `yaml:"group,omitempty"`
+}
+
+// ArtifactUserGroup is a system user or group created by the package
+type ArtifactUserGroup struct {
+	Name string `yaml:"name"`
+}
+
+// ImageConfig is the container image configuration
+type ImageConfig struct {
+	Entrypoint string              `yaml:"entrypoint,omitempty"`
+	Cmd        string              `yaml:"cmd,omitempty"`
+	Env        []string            `yaml:"env,omitempty"`
+	Labels     map[string]string   `yaml:"labels,omitempty"`
+	Volumes    map[string]struct{} `yaml:"volumes,omitempty"`
+	WorkingDir string              `yaml:"workdir,omitempty"`
+	StopSignal string              `yaml:"stop_signal,omitempty"`
+	User       string              `yaml:"user,omitempty"`
+	Base       string              `yaml:"base,omitempty"` // Deprecated in Dalec in favor of Bases
+	Bases      []BaseImage         `yaml:"bases,omitempty"`
+	Post       *PostInstall        `yaml:"post,omitempty"`
+}
+
+// BaseImage is an image the package is installed into
+type BaseImage struct {
+	Rootfs Source `yaml:"rootfs"`
+}
+
+// PostInstall runs after the package is installed in the image
+type PostInstall struct {
+	Symlinks map[string]SymlinkTarget `yaml:"symlinks,omitempty"`
+}
+
+// SymlinkTarget is the file a symlink points to
+type SymlinkTarget struct {
+	Path string `yaml:"path"`
+}
+
+// TestSpec is a test run against the built package
+type TestSpec struct {
+	Name  string              `yaml:"name"`
+	Dir   string              `yaml:"dir,omitempty"`
+	Env   map[string]string   `yaml:"env,omitempty"`
+	Steps []TestStep          `yaml:"steps,omitempty"`
+	Files map[string]FileTest `yaml:"files,omitempty"`
+}
+
+// TestStep is a command run by a test
+type TestStep struct {
+	Command string            `yaml:"command"`
+	Env     map[string]string `yaml:"env,omitempty"`
+	Stdout  *OutputCheck      `yaml:"stdout,omitempty"`
+	Stderr  *OutputCheck      `yaml:"stderr,omitempty"`
+}
+
+// FileTest checks a file in the built image
+type FileTest struct {
+	NotExist    bool   `yaml:"not_exist,omitempty"`
+	IsDir       bool   `yaml:"is_dir,omitempty"`
+	Permissions uint32 `yaml:"permissions,omitempty"`
+	OutputCheck `yaml:",inline"`
+}
+
+// OutputCheck matches command output or file contents
+type OutputCheck struct {
+	Equals     string   `yaml:"equals,omitempty"`
+	Contains   []string `yaml:"contains,omitempty"`
+	Matches    []string `yaml:"matches,omitempty"`
+	StartsWith string   `yaml:"starts_with,omitempty"`
+	EndsWith   string   `yaml:"ends_with,omitempty"`
+	Empty      bool     `yaml:"empty,omitempty"`
+}
+
+// SpecFromMap converts the map IR to the typed model
+// Unknown fields and values of the wrong shape (a list where Dalec expects a map) are errors
+func SpecFromMap(spec DalecSpec) (*Spec, error) {
+	// Comments are writer metadata, only the syntax header has a field
+	fields := make(map[string]interface{})
+	for k, v := range spec {
+		if !isCommentKey(k) || k == syntaxKey {
+			fields[k] = v
+		}
+	}
+
+	data, err := yaml.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode spec: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	typed := &Spec{}
+	if err := decoder.Decode(typed); err != nil {
+		return nil, fmt.Errorf("invalid spec structure: %w", err)
+	}
+
+	return typed, nil
+}
+
+// ToMap converts the typed model back to the map IR
+func (s *Spec) ToMap() (DalecSpec, error) {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode spec: %w", err)
+	}
+
+	spec := make(DalecSpec)
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to decode spec: %w", err)
+	}
+
+	return spec, nil
+}
+
+// Validate checks the rules Dalec enforces that the struct types cannot express
+// All problems are returned together
+func (s *Spec) Validate() error {
+	var errs []error
+
+	if s.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+
+	for _, key := range sortedKeys(s.Extensions) {
+		if !strings.HasPrefix(key, "x-") {
+			errs = append(errs, fmt.Errorf("unknown field %q (extensions must start with x-)", key))
+		}
+	}
+
+	for _, name := range sortedKeys(s.Sources) {
+		errs = append(errs, s.Sources[name].validate(name)...)
+	}
+
+	if s.Build != nil {
+		for i, cache := range s.Build.Caches {
+			if count(cache.Dir != nil, cache.GoBuild != nil) != 1 {
+				errs = append(errs, fmt.Errorf("build.caches[%d]: exactly one of dir or gobuild must be set", i))
+			}
+			if cache.Dir != nil && (cache.Dir.Key == "" || cache.Dir.Dest == "") {
+				errs = append(errs, fmt.Errorf("build.caches[%d].dir: key and dest are required", i))
+			}
+		}
+		for i, step := range s.Build.Steps {
+			if strings.TrimSpace(step.Command) == "" {
+				errs = append(errs, fmt.Errorf("build.steps[%d]: command is required", i))
+			}
+		}
+	}
+
+	if s.Image != nil && s.Image.Post != nil {
+		for _, link := range sortedKeys(s.Image.Post.Symlinks) {
+			if s.Image.Post.Symlinks[link].Path == "" {
+				errs = append(errs, fmt.Errorf("image.post.symlinks.%s: path is required", link))
+			}
+		}
+	}
+
+	for i, test := range s.Tests {
+		if test.Name == "" {
+			errs = append(errs, fmt.Errorf("tests[%d]: name is required", i))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate checks that a source has exactly one type and one generator per entry
+func (src Source) validate(name string) []error {
+	var errs []error
+
+	if count(src.Git != nil, src.HTTP != nil, src.Image != nil, src.Inline != nil, src.Context != nil, src.Build != nil) != 1 {
+		errs = append(errs, fmt.Errorf("sources.%s: exactly one of git, http, image, inline, context or build must be set", name))
+	}
+	if src.Git != nil && src.Git.Commit == "" {
+		errs = append(errs, fmt.Errorf("sources.%s.git: commit is required", name))
+	}
+	if src.Inline != nil && count(src.Inline.File != nil, src.Inline.Dir != nil) != 1 {
+		errs = append(errs, fmt.Errorf("sources.%s.inline: exactly one of file or dir must be set", name))
+	}
+	for i, g := range src.Generate {
+		if count(g.Gomod != nil, g.Cargohome != nil, g.Nodemod != nil, g.Pip != nil) != 1 {
+			errs = append(errs, fmt.Errorf("sources.%s.generate[%d]: exactly one generator must be set", name, i))
+		}
+	}
+
+	return errs
+}
+
+// Validate checks the structure of the map IR against the typed model
+func (spec DalecSpec) Validate() error {
+	typed, err := SpecFromMap(spec)
+	if err != nil {
+		return err
+	}
+	return typed.Validate()
+}
+
+// count returns how many of the conditions are true
+func count(conds ...bool) int {
+	n := 0
+	for _, c := range conds {
+		if c {
+			n++
+		}
+	}
+	return n
+}
+
+// sortedKeys returns the keys of a map in order, for stable error messages
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,102 @@
+package transformer
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSpecFromMapAcceptsDalecFields(t *testing.T) {
+	// Fields the generator never writes but users add when editing the spec
+	edited := `name: app
+sources:
+  app:
+    git:
+      url: https://github.com/owner/app
+      commit: abc
+  tools:
+    image:
+      ref: golang:1.22
+      cmd:
+        dir: /out
+        steps:
+          - command: go install example.com/tool@latest
+  web:
+    build:
+      source:
+        context: {}
+      dockerfile_path: web/Dockerfile
+      target: dist
+targets:
+  azlinux3:
+    package_config:
+      signer:
+        image: example.com/signer:latest
+artifacts:
+  systemd:
+    units:
+      app.service:
+        enable: true
+  links:
+    - source: /usr/bin/app
+      dest: /usr/bin/app-cli
+  createDirectories:
+    state:
+      app:
+        mode: 0o750
+  users:
+    - name: app
+  groups:
+    - name: app
+image:
+  workdir: /var/lib/app
+  bases:
+    - rootfs:
+        image:
+          ref: mcr.microsoft.com/azurelinux/distroless/base:3.0
+tests: []
+`
+	var spec DalecSpec
+	if err := yaml.Unmarshal([]byte(edited), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	typed, err := SpecFromMap(spec)
+	if err != nil {
+		t.Fatalf("SpecFromMap: %v", err)
+	}
+	if err := typed.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	if typed.Image.WorkingDir != "/var/lib/app" {
+		t.Errorf("image.workdir = %q, want /var/lib/app", typed.Image.WorkingDir)
+	}
+	if typed.Sources["web"].Build == nil || typed.Sources["web"].Build.Source.Context == nil {
+		t.Errorf("sources.web.build = %+v, want a context build", typed.Sources["web"].Build)
+	}
+}
+
+func TestSpecFromMapRejectsUnknownFields(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want string
+	}{
+		{"image working_dir", "name: app\nimage:\n  working_dir: /app\n", "working_dir"},
+		{"misspelled artifact kind", "name: app\nartifacts:\n  binary:\n    app: {}\n", "binary"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spec DalecSpec
+			if err := yaml.Unmarshal([]byte(tt.spec), &spec); err != nil {
+				t.Fatal(err)
+			}
+			_, err := SpecFromMap(spec)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("SpecFromMap error = %v, want one naming %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package transformer
+
+import (
+	"dalec-mapping/parser"
+)
+
+// Stage roles are derived from the stage graph instead of stage names:
+// - runtime stages: the target stage and the stages it is built FROM
+// - builder stages: every other stage reachable from the target
+// Stages the target never reaches (test, lint, ...) are ignored.
+
+// runtimeStages returns the target stage followed by the stages it is built FROM
+func runtimeStages(info *parser.DockerfileInfo) []parser.Stage {
+	var stages []parser.Stage
+
+	for stage := info.TargetStage(); stage != nil; {
+		stages = append(stages, *stage)
+		if stage.BaseStage < 0 {
+			break
+		}
+		stage = &info.Stages[stage.BaseStage]
+	}
+
+	return stages
+}
+
+// builderStages returns the reachable stages that produce files for the target,
+// in Dockerfile order. A single-stage Dockerfile builds in its only stage.
+func builderStages(info *parser.DockerfileInfo) []parser.Stage {
+	runtime := make(map[int]bool)
+	for _, stage := range runtimeStages(info) {
+		runtime[stage.Index] = true
+	}
+
+	var builders []parser.Stage
+	for _, stage := range info.ReachableStages() {
+		if !runtime[stage.Index] {
+			builders = append(builders, stage)
+		}
+	}
+
+	if len(builders) == 0 {
+		if target := info.TargetStage(); target != nil {
+			builders = append(builders, *target)
+		}
+	}
+
+	return builders
+}
+
+// stageRoles are the builder and runtime stages by index, computed once per
+// conversion step instead of walking the stage graph for every lookup.
+// In a single-stage Dockerfile the target stage is both.
+type stageRoles struct {
+	builders map[int]bool
+	runtime  map[int]bool
+}
+
+// rolesOf computes the stage roles of info
+func rolesOf(info *parser.DockerfileInfo) stageRoles {
+	roles := stageRoles{builders: make(map[int]bool), runtime: make(map[int]bool)}
+	for _, stage := range builderStages(info) {
+		roles.builders[stage.Index] = true
+	}
+	for _, stage := range runtimeStages(info) {
+		roles.runtime[stage.Index] = true
+	}
+	return roles
+}
+
+// isBuilder reports whether the stage at index is one of builderStages
+func (r stageRoles) isBuilder(index int) bool {
+	return r.builders[index]
+}
+
+// isRuntime reports whether the stage at index is one of runtimeStages
+func (r stageRoles) isRuntime(index int) bool {
+	return r.runtime[index]
+}
+
+// copiesFromBuilder reports whether a COPY/ADD takes files out of a builder stage
+func (r stageRoles) copiesFromBuilder(copy parser.CopyInstruction) bool {
+	return copy.FromStage >= 0 && r.isBuilder(copy.FromStage)
+}
@@ -2,11 +2,15 @@ package transformer
 
 import (
 	"fmt"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"dalec-mapping/diagnostics"
+	"dalec-mapping/mapping"
 	"dalec-mapping/parser"
+	"dalec-mapping/toolchain"
 )
 
 // DalecSpec represents a Dalec specification using flexible maps for dynamic keys
@@ -24,20 +28,41 @@ type RepoMetadata struct {
 	Description string
 	License     string
 	RepoName    string
+	Version     string // Release version from a git tag, without the leading "v"; empty if unknown
+}
+
+// Options controls how the spec is generated
+type Options struct {
+	PackageMap  *mapping.Table   // Package name mapping to Dalec targets (default: mapping.Builtin())
+	Toolchains  *toolchain.Table // Base image toolchain detection (default: toolchain.Builtin())
+	Repo        RepoFiles        // Repository checkout for language detectors, may be nil
+	ToolVersion string           // dalec-mapping version for the provenance header
 }
 
 // TransformToDalec converts parsed Dockerfile info to Dalec spec format
 // repoMeta can be nil if no repository metadata is available
-func TransformToDalec(repoInfo *RepoMetadata, previousSpec PreviousDalecSpec, dockerInfo *parser.DockerfileInfo) DalecSpec {
-	rebuild(repoInfo, previousSpec)
+// The returned diagnostics point at the Dockerfile lines that need manual review
+func TransformToDalec(repoInfo *RepoMetadata, previousSpec PreviousDalecSpec, dockerInfo *parser.DockerfileInfo, opts Options) (DalecSpec, *diagnostics.Collector) {
+	diags := &diagnostics.Collector{}
+	if opts.PackageMap == nil {
+		opts.PackageMap = mapping.Builtin()
+	}
+	if opts.Toolchains == nil {
+		opts.Toolchains = toolchain.Builtin()
+	}
+	if dockerInfo != nil {
+		reportWarnings(dockerInfo, diags)
+	}
 
 	spec := make(DalecSpec)
 
 	// Add syntax header (special comment format)
 	spec["# syntax"] = "ghcr.io/azure/dalec/frontend:latest"
 
-	// Initialize args section
-	spec["args"] = populateArgs(repoInfo, dockerInfo)
+	// Initialize args section, with VERSION and REVISION continued from the previous spec
+	args := populateArgs(repoInfo, dockerInfo)
+	rebuild(args, repoInfo, dockerInfo, previousSpec, diags)
+	spec["args"] = args
 
 	packageName := derivePackageName(dockerInfo)
 	if repoInfo != nil && repoInfo.RepoName != "" {
@@ -49,38 +74,98 @@ func TransformToDalec(repoInfo *RepoMetadata, previousSpec PreviousDalecSpec, do
 	// Build extensions section
 	spec["x-build-extensions"] = buildExtensions(packageName)
 
+	// Record what the spec was generated from
+	addProvenance(spec, repoInfo, dockerInfo, opts)
+
 	// Transform Dockerfile content to Dalec sections
 	if dockerInfo != nil {
-		spec["sources"] = extractSources(dockerInfo, repoInfo)
-		spec["dependencies"] = extractDependencies(dockerInfo)
-		spec["targets"] = extractTargets(dockerInfo)
-		spec["build"] = extractBuildSteps(dockerInfo)
-		spec["artifacts"] = extractArtifacts(dockerInfo)
-		spec["image"] = extractImageConfig(dockerInfo)
+		// Language detectors contribute generators, env, dependencies and artifacts
+		contributions := runDetectors(dockerInfo, packageName, opts, diags)
+
+		// Heredoc and image files become sources next to the git source, all with unique names
+		used := map[string]bool{primarySourceName(dockerInfo, repoInfo): true}
+		inlineFiles := collectInlineFiles(dockerInfo, used)
+		imageFiles := collectImageFiles(dockerInfo, used)
+
+		spec["sources"] = extractSources(dockerInfo, repoInfo, inlineFiles, imageFiles, contributions, diags)
+		markSourceURLs(spec)
+		packages := mapPackages(dockerInfo, collectPackages(dockerInfo), opts.PackageMap, diags)
+		dependencies := extractDependencies(dockerInfo, packages, opts.Toolchains, contributions, diags)
+		spec["dependencies"] = dependencies
+		markUnmappedPackages(spec, packages)
+		spec["targets"] = extractTargets(dependencies, packages, contributions)
+		spec["build"] = extractBuildSteps(dockerInfo, packageName, contributions, diags)
+		spec["artifacts"] = extractArtifacts(dockerInfo, inlineFiles, contributions, diags)
+		spec["image"] = extractImageConfig(dockerInfo, diags)
 	}
 	spec["tests"] = []map[string]interface{}{} // Empty placeholder
 
-	return spec
+	// Catch typos and wrongly shaped sections before the Dalec frontend does
+	if err := spec.Validate(); err != nil {
+		diags.Errorf(diagnostics.Position{}, "generated spec does not match the Dalec schema: %v", err)
+	}
+
+	return spec, diags
 }
 
-func rebuild(repoInfo *RepoMetadata, previousSpec PreviousDalecSpec) bool {
+// rebuild continues the release numbering of the previous spec in args:
+// the same commit and version is a rebuild and bumps REVISION, a new commit or
+// version starts again at REVISION 1. The reasoning is reported as info.
+func rebuild(args map[string]interface{}, repoInfo *RepoMetadata, dockerInfo *parser.DockerfileInfo, previousSpec PreviousDalecSpec, diags *diagnostics.Collector) {
+	pos := diagnostics.Position{File: previousSpec.Path}
 	if previousSpec.Commit == "" {
-		return false
+		diags.Infof(pos, "no previous COMMIT, starting at VERSION %v REVISION %v", args["VERSION"], args["REVISION"])
+		return
 	}
 
-	if previousSpec.Commit == repoInfo.Commit {
-		prevRevision, err := strconv.Atoi(previousSpec.Revision)
-		if err != nil {
-			prevRevision = 0
-			fmt.Printf("⚠️  Warning: invalid previous revision '%s', resetting to 1\n", previousSpec.Revision)
-			return false
+	commit := fmt.Sprint(args["COMMIT"])
+	version, versionSource := releaseVersion(repoInfo, dockerInfo)
+	if version == "" {
+		// Nothing says which version this commit is; it can only be the previous one
+		version = previousSpec.Version
+	}
+	if version != "" {
+		args["VERSION"] = version
+	}
+
+	switch {
+	case commit != previousSpec.Commit:
+		args["REVISION"] = "1"
+		if versionSource == "" {
+			diags.Warnf(pos, "COMMIT changed from %s to %s but no tag or VERSION ARG gives the new version, VERSION %v kept; update it manually",
+				previousSpec.Commit, commit, args["VERSION"])
+			return
 		}
+		diags.Infof(pos, "COMMIT changed from %s to %s, VERSION %s (from %s), REVISION reset to 1", previousSpec.Commit, commit, version, versionSource)
+
+	case version != previousSpec.Version:
+		args["REVISION"] = "1"
+		diags.Infof(pos, "VERSION changed from %s to %s (from %s) at the same COMMIT, REVISION reset to 1", previousSpec.Version, version, versionSource)
 
-		previousSpec.Revision = fmt.Sprintf("%d", prevRevision+1)
-		return false
+	default:
+		prevRevision, err := strconv.Atoi(previousSpec.Revision)
+		if err != nil || prevRevision < 1 {
+			args["REVISION"] = "1"
+			diags.Warnf(pos, "invalid previous revision '%s', resetting to 1", previousSpec.Revision)
+			return
+		}
+		args["REVISION"] = strconv.Itoa(prevRevision + 1)
+		diags.Infof(pos, "COMMIT %s and VERSION %s unchanged since the previous spec, REVISION bumped from %d to %d", commit, version, prevRevision, prevRevision+1)
 	}
+}
 
-	return true
+// releaseVersion returns the version of the packaged commit and where it came from:
+// the release tag, or the Dockerfile's VERSION ARG. Both empty if neither is known.
+func releaseVersion(repoInfo *RepoMetadata, dockerInfo *parser.DockerfileInfo) (version, source string) {
+	if repoInfo != nil && repoInfo.Version != "" {
+		return repoInfo.Version, "tag"
+	}
+	if dockerInfo != nil {
+		if v := getArgValueOrDefault(dockerInfo, "VERSION", nil); v != nil {
+			return fmt.Sprint(v), "Dockerfile ARG VERSION"
+		}
+	}
+	return "", ""
 }
 
 func populateArgs(repoMeta *RepoMetadata, dockerInfo *parser.DockerfileInfo) map[string]interface{} {
@@ -97,13 +182,16 @@ func populateArgs(repoMeta *RepoMetadata, dockerInfo *parser.DockerfileInfo) map
 	args := make(map[string]interface{})
 	args["REVISION"] = getArgValueOrDefault(dockerInfo, "REVISION", "1")
 	args["VERSION"] = getArgValueOrDefault(dockerInfo, "VERSION", "0.1")
+	if repoMeta != nil && repoMeta.Version != "" {
+		args["VERSION"] = repoMeta.Version
+	}
 
-	// Use commit from repo metadata if available
-	commitValue := ""
+	// The resolved commit (and its tag's version) win over Dockerfile defaults, so
+	// VERSION and COMMIT always describe the same release
+	args["COMMIT"] = getArgValueOrDefault(dockerInfo, "COMMIT", "")
 	if repoMeta != nil && repoMeta.Commit != "" {
-		commitValue = repoMeta.Commit
+		args["COMMIT"] = repoMeta.Commit
 	}
-	args["COMMIT"] = getArgValueOrDefault(dockerInfo, "COMMIT", commitValue)
 	args["TARGETARCH"] = getArgValueOrDefault(dockerInfo, "TARGETARCH", "")
 	args["TARGETOS"] = getArgValueOrDefault(dockerInfo, "TARGETOS", "")
 
@@ -119,51 +207,115 @@ func populateMetadata(spec DalecSpec, repoMeta *RepoMetadata) {
 	if repoMeta != nil && repoMeta.License != "" {
 		spec["license"] = repoMeta.License
 	} else {
-		spec["license"] = "" // TODO: needs manual input
+		spec["license"] = ""
+		spec.TODO("add the SPDX license identifier", "license")
 	}
 
 	if repoMeta != nil && repoMeta.Website != "" {
 		spec["website"] = repoMeta.Website
 	} else {
-		spec["website"] = "" // TODO: needs manual input
+		spec["website"] = ""
+		spec.TODO("add the project website", "website")
 	}
 
 	if repoMeta != nil && repoMeta.Description != "" {
 		spec["description"] = repoMeta.Description
 	} else {
-		spec["description"] = "" // TODO: needs manual input
+		spec["description"] = ""
+		spec.TODO("add a one-line package description", "description")
 	}
 
 	spec["version"] = "${VERSION}"
 	spec["revision"] = "${REVISION}"
 }
 
-// TODO: Understand docker stages for package naming
+// addProvenance writes the tool version, repository, commit and Dockerfile into the spec header
+func addProvenance(spec DalecSpec, repoMeta *RepoMetadata, dockerInfo *parser.DockerfileInfo, opts Options) {
+	toolVersion := opts.ToolVersion
+	if toolVersion == "" {
+		toolVersion = "dev"
+	}
+	spec.Header("Generated by dalec-mapping " + toolVersion)
+
+	if repoMeta != nil {
+		repo := repoMeta.GitURL
+		if repo == "" {
+			repo = repoMeta.RepoName
+		}
+		if repo != "" {
+			spec.Header("Repository: " + repo)
+		}
+		if repoMeta.Commit != "" {
+			spec.Header("Commit: " + repoMeta.Commit)
+		}
+	}
+
+	if dockerInfo != nil && dockerInfo.Path != "" {
+		spec.Header("Dockerfile: " + dockerfilePath(dockerInfo.Path, opts.Repo))
+	}
+}
+
+// dockerfilePath returns the Dockerfile path relative to the checkout (or the
+// working directory without one), so the header does not depend on where the
+// tool ran; a Dockerfile outside of both is recorded by its file name
+func dockerfilePath(path string, repo RepoFiles) string {
+	base := "."
+	if dir, ok := repo.(DirFiles); ok {
+		base = string(dir)
+	}
+
+	absBase, errBase := filepath.Abs(base)
+	absPath, errPath := filepath.Abs(path)
+	if errBase == nil && errPath == nil {
+		if rel, err := filepath.Rel(absBase, absPath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(path)
+}
+
+// markSourceURLs adds a TODO to git sources without a repository URL
+func markSourceURLs(spec DalecSpec) {
+	sources, _ := spec["sources"].(map[string]interface{})
+	for name, source := range sources {
+		src, _ := source.(map[string]interface{})
+		if git, ok := src["git"].(map[string]interface{}); ok && git["url"] == "" {
+			spec.TODO("set the git repository URL", "sources", name, "git", "url")
+		}
+	}
+}
+
+// markUnmappedPackages adds a TODO to dependencies that were kept under their Dockerfile name
+func markUnmappedPackages(spec DalecSpec, packages packageDeps) {
+	for kind, names := range packages.Unmapped {
+		for name, manager := range names {
+			spec.TODO(fmt.Sprintf("no package mapping for %s package %s, check the name on the Dalec targets", manager, name), "dependencies", kind, name)
+		}
+	}
+}
+
 // derivePackageName extracts a package name from Dockerfile info
 func derivePackageName(info *parser.DockerfileInfo) string {
-	if info == nil || len(info.Stages) == 0 {
+	if info == nil || info.TargetStage() == nil {
 		return "package"
 	}
 
-	// Look at final stage names
-	for i := len(info.Stages) - 1; i >= 0; i-- {
-		stage := info.Stages[i]
-		if stage.Name != "" && stage.Name != "builder" && stage.Name != "build" {
-			// Use stage name if it's a meaningful final stage
-			if stage.Name == "linux" || stage.Name == "windows" {
-				continue // Skip OS-specific stages
-			}
-			return strings.ToLower(stage.Name)
-		}
+	// Use the target stage name if it's meaningful
+	switch name := strings.ToLower(info.TargetStage().Name); name {
+	case "", "builder", "build", "linux", "windows":
+		// Generic or OS-specific stage names
+	default:
+		return name
 	}
 
 	// Check for binary names in COPY instructions
-	for i := len(info.Stages) - 1; i >= 0; i-- {
-		for _, copy := range info.Stages[i].Copies {
-			if copy.From == "builder" {
+	roles := rolesOf(info)
+	for _, stage := range runtimeStages(info) {
+		for _, copy := range stage.Copies {
+			if roles.copiesFromBuilder(copy) {
 				for _, src := range copy.Source {
-					if strings.Contains(src, "/bin/") {
-						name := filepath.Base(src)
+					if isBinaryPath(src.Expanded) {
+						name := filepath.Base(src.Expanded)
 						name = strings.TrimSuffix(name, ".exe")
 						if name != "" {
 							return strings.ToLower(name)
@@ -198,45 +350,62 @@ func buildExtensions(packageName string) map[string]interface{} {
 	return ext
 }
 
-// extractSources creates source definitions from Dockerfile
-func extractSources(info *parser.DockerfileInfo, repoMeta *RepoMetadata) map[string]interface{} {
-	sources := make(map[string]interface{})
-
-	// Determine source name from repo metadata or derive from Dockerfile
-	sourceName := "source"
+// primarySourceName names the git source: the repository name, or the WORKDIR
+// of the first builder stage
+func primarySourceName(info *parser.DockerfileInfo, repoMeta *RepoMetadata) string {
 	if repoMeta != nil && repoMeta.RepoName != "" {
-		sourceName = repoMeta.RepoName
+		return repoMeta.RepoName
 	}
+	for _, stage := range builderStages(info) {
+		return deriveSourceName(stage)
+	}
+	return "source"
+}
 
-	// Find builder stages with actual builds
-	for _, stage := range info.Stages {
-		if isBuilderStage(stage) {
-			if sourceName == "source" {
-				sourceName = deriveSourceName(stage)
-			}
+// uniqueSourceName returns base, or base-2, base-3, ... if the name is taken, and marks it used
+func uniqueSourceName(base string, used map[string]bool) string {
+	name := base
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	used[name] = true
+	return name
+}
 
-			source := make(map[string]interface{})
+// extractSources creates source definitions from Dockerfile
+func extractSources(info *parser.DockerfileInfo, repoMeta *RepoMetadata, inlineFiles []inlineFile, imageFiles []imageFile, contributions []Contribution, diags *diagnostics.Collector) map[string]interface{} {
+	sources := make(map[string]interface{})
+	sourceName := primarySourceName(info, repoMeta)
 
-			// Git source - use repo metadata if available
-			git := make(map[string]interface{})
-			if repoMeta != nil && repoMeta.GitURL != "" {
-				git["url"] = repoMeta.GitURL
-			} else {
-				git["url"] = "" // TODO: needs manual input
-			}
-			git["commit"] = "${COMMIT}"
-			source["git"] = git
+	// Find builder stages with actual builds
+	for range builderStages(info) {
+		source := make(map[string]interface{})
+
+		// Git source - use repo metadata if available
+		git := make(map[string]interface{})
+		if repoMeta != nil && repoMeta.GitURL != "" {
+			git["url"] = repoMeta.GitURL
+		} else {
+			git["url"] = "" // TODO: needs manual input
+		}
+		git["commit"] = "${COMMIT}"
+		source["git"] = git
 
-			// Check for language-specific generators
-			if hasGoModules(stage) {
-				source["generate"] = []map[string]interface{}{
-					{"gomod": map[string]interface{}{}},
+		// Language-specific generators from the detectors
+		var generate []map[string]interface{}
+		for _, c := range contributions {
+			for _, g := range c.Generators {
+				if !hasGenerator(generate, g) {
+					generate = append(generate, g)
 				}
 			}
-
-			sources[sourceName] = source
-			break // Use first builder stage
 		}
+		if len(generate) > 0 {
+			source["generate"] = generate
+		}
+
+		sources[sourceName] = source
+		break // Use first builder stage
 	}
 
 	// Fallback if no builder found
@@ -255,75 +424,142 @@ func extractSources(info *parser.DockerfileInfo, repoMeta *RepoMetadata) map[str
 		sources[sourceName] = source
 	}
 
+	// COPY <<EOF heredocs become generated inline file sources
+	for _, file := range inlineFiles {
+		sources[file.SourceName] = inlineSource(file)
+	}
+
+	// COPY --from=<image> becomes an image source instead of vanishing
+	for _, file := range imageFiles {
+		sources[file.SourceName] = imageSource(file)
+	}
+	warnImageFiles(info, imageFiles, diags)
+
 	return sources
 }
 
 // extractDependencies extracts build and runtime dependencies
-
-// extractDependencies extracts build and runtime dependencies
-func extractDependencies(info *parser.DockerfileInfo) map[string]interface{} {
+func extractDependencies(info *parser.DockerfileInfo, packages packageDeps, toolchains *toolchain.Table, contributions []Contribution, diags *diagnostics.Collector) map[string]interface{} {
 	deps := make(map[string]interface{})
 	buildDeps := make(map[string]interface{})
+	runtimeDeps := make(map[string]interface{})
 
-	// Detect language/framework dependencies
-	for _, stage := range info.Stages {
-		// Check for Go
-		if hasGoModules(stage) || stage.From == "go" || strings.Contains(stage.From, "golang") {
-			buildDeps["msft-golang"] = map[string]interface{}{}
+	// OS packages with the same name on every target
+	for name, constraint := range packages.Common["build"] {
+		buildDeps[name] = constraint
+	}
+	for name, constraint := range packages.Common["runtime"] {
+		runtimeDeps[name] = constraint
+	}
+
+	// Detect language toolchains from the base images; a toolchain image used
+	// by a builder stage is a build dependency, one the image runs on a runtime dependency
+	roles := rolesOf(info)
+	for _, stage := range info.ReachableStages() {
+		stageDeps := buildDeps
+		if !roles.isBuilder(stage.Index) {
+			stageDeps = runtimeDeps
 		}
 
-		// Check for package manager installs
-		for _, run := range stage.Runs {
-			run = strings.ToLower(run)
-			// tdnf, yum, apt, etc.
-			if strings.Contains(run, "tdnf install") || strings.Contains(run, "yum install") {
-				// Could parse package names, for now leave as TODO
-			}
+		if tc, ok := toolchains.Detect(stage.Image); ok {
+			addToolchain(stageDeps, tc)
+			diags.Infof(at(info, stage.Location), "%s toolchain %s from base image %s", tc.Name, tc.Package, stage.Image)
 		}
 	}
 
+	// Language detectors add their toolchains for builds on other images
+	for _, c := range contributions {
+		mergeDeps(buildDeps, c.Build)
+		mergeDeps(runtimeDeps, c.Runtime)
+	}
+
 	if len(buildDeps) > 0 {
 		deps["build"] = buildDeps
 	}
+	if len(runtimeDeps) > 0 {
+		deps["runtime"] = runtimeDeps
+	}
 
 	return deps
 }
 
+// addToolchain records a toolchain dependency
+// The first versioned constraint wins; an unversioned one never replaces it
+func addToolchain(deps map[string]interface{}, tc toolchain.Toolchain) {
+	if existing, ok := deps[tc.Package].(map[string]interface{}); ok && (len(existing) > 0 || tc.Version == "") {
+		return
+	}
+
+	dep := map[string]interface{}{}
+	if constraint := tc.Constraint(); constraint != "" {
+		dep["version"] = []string{constraint}
+	}
+	deps[tc.Package] = dep
+}
+
 // extractTargets creates target-specific configurations
-func extractTargets(info *parser.DockerfileInfo) map[string]interface{} {
+// Dalec uses the dependencies of a target instead of the top-level ones, not in
+// addition to them, so every target with its own dependencies gets a copy of common
+func extractTargets(common map[string]interface{}, packages packageDeps, contributions []Contribution) map[string]interface{} {
 	targets := make(map[string]interface{})
 
-	// Add standard Azure Linux target with required dependencies
-	azlinux3 := make(map[string]interface{})
-	runtimeDeps := make(map[string]interface{})
-
-	// Check if this is a Go binary (requires crypto dependencies)
-	hasGo := false
-	for _, stage := range info.Stages {
-		if hasGoModules(stage) {
-			hasGo = true
-			break
-		}
+	// Target-specific dependencies from the detectors (e.g. Go's crypto libraries
+	// on Azure Linux) and OS packages translated to target-specific names
+	all := []map[string]map[string]map[string]interface{}{}
+	for _, c := range contributions {
+		all = append(all, c.Targets)
 	}
+	all = append(all, packages.Targets)
 
-	if hasGo {
-		runtimeDeps["openssl-libs"] = map[string]interface{}{}
-		runtimeDeps["SymCrypt"] = map[string]interface{}{}
-		runtimeDeps["SymCrypt-OpenSSL"] = map[string]interface{}{}
+	for _, perTarget := range all {
+		addTargetDeps(targets, perTarget)
 	}
 
-	if len(runtimeDeps) > 0 {
-		azlinux3["dependencies"] = map[string]interface{}{
-			"runtime": runtimeDeps,
+	for _, config := range targets {
+		deps, _ := config.(map[string]interface{})["dependencies"].(map[string]interface{})
+		if deps == nil {
+			continue
+		}
+		for kind, names := range common {
+			kindDeps, ok := deps[kind].(map[string]interface{})
+			if !ok {
+				kindDeps = make(map[string]interface{})
+				deps[kind] = kindDeps
+			}
+			mergeDeps(kindDeps, names.(map[string]interface{}))
 		}
-		targets["azlinux3"] = azlinux3
 	}
 
 	return targets
 }
 
+// addTargetDeps merges target → kind → package dependencies into the targets section
+func addTargetDeps(targets map[string]interface{}, perTarget map[string]map[string]map[string]interface{}) {
+	for target, kinds := range perTarget {
+		config, ok := targets[target].(map[string]interface{})
+		if !ok {
+			config = make(map[string]interface{})
+			targets[target] = config
+		}
+		deps, ok := config["dependencies"].(map[string]interface{})
+		if !ok {
+			deps = make(map[string]interface{})
+			config["dependencies"] = deps
+		}
+
+		for kind, names := range kinds {
+			kindDeps, ok := deps[kind].(map[string]interface{})
+			if !ok {
+				kindDeps = make(map[string]interface{})
+				deps[kind] = kindDeps
+			}
+			mergeDeps(kindDeps, names)
+		}
+	}
+}
+
 // extractBuildSteps converts RUN commands to Dalec build steps
-func extractBuildSteps(info *parser.DockerfileInfo) map[string]interface{} {
+func extractBuildSteps(info *parser.DockerfileInfo, packageName string, contributions []Contribution, diags *diagnostics.Collector) map[string]interface{} {
 	build := make(map[string]interface{})
 
 	// Extract environment variables
@@ -331,21 +567,26 @@ func extractBuildSteps(info *parser.DockerfileInfo) map[string]interface{} {
 	env["VERSION"] = "${VERSION}"
 
 	// Collect env vars from builder stages
-	for _, stage := range info.Stages {
-		if isBuilderStage(stage) {
-			for k, v := range stage.Env {
-				// Skip build args that are already in args section
-				if k != "OS" && k != "ARCH" && k != "VERSION" {
-					env[k] = v
-				}
+	for _, stage := range builderStages(info) {
+		for k, v := range stage.Env {
+			// Skip build args that are already in args section
+			if k != "OS" && k != "ARCH" && k != "VERSION" {
+				env[k] = pickWord(v, specArgNames())
 			}
+		}
+	}
 
-			// Add Go-specific env vars if it's a Go build
-			if hasGoModules(stage) {
-				env["GOPROXY"] = "direct"
-				env["GOEXPERIMENT"] = "systemcrypto"
-				env["CGO_ENABLED"] = "1"
+	// Language-specific env vars from the detectors fill in what the Dockerfile
+	// leaves unset; an explicit ENV (e.g. CGO_ENABLED=0) is kept
+	for _, c := range contributions {
+		for _, k := range sortedKeys(c.Env) {
+			if current, ok := env[k]; ok {
+				if current != c.Env[k] {
+					diags.Infof(diagnostics.Position{File: info.Path}, "kept build.env %s=%s from the Dockerfile instead of the detected default %s", k, current, c.Env[k])
+				}
+				continue
 			}
+			env[k] = c.Env[k]
 		}
 	}
 
@@ -353,8 +594,21 @@ func extractBuildSteps(info *parser.DockerfileInfo) map[string]interface{} {
 		build["env"] = env
 	}
 
-	// Extract build steps
-	steps := extractBuildCommands(info)
+	// Map RUN --mount=type=cache to Dalec build caches
+	caches := extractCaches(info, packageName, diags)
+	if len(caches) > 0 {
+		build["caches"] = caches
+	}
+
+	// Extract build steps (they may reference the build env and spec args)
+	available := specArgNames()
+	for k := range env {
+		available[k] = true
+	}
+	steps := extractBuildCommands(info, available, diags)
+	for _, c := range contributions {
+		steps = append(steps, c.Steps...)
+	}
 	if len(steps) > 0 {
 		build["steps"] = steps
 	}
@@ -363,73 +617,174 @@ func extractBuildSteps(info *parser.DockerfileInfo) map[string]interface{} {
 }
 
 // extractBuildCommands extracts build commands from builder stages
-func extractBuildCommands(info *parser.DockerfileInfo) []map[string]interface{} {
+// Each RUN becomes its own step that starts in the WORKDIR of the RUN, like in
+// Docker, so a cd in one RUN does not leak into the next one
+// available lists the variables the Dalec build provides to each step
+func extractBuildCommands(info *parser.DockerfileInfo, available map[string]bool, diags *diagnostics.Collector) []map[string]interface{} {
 	var steps []map[string]interface{}
 
-	for _, stage := range info.Stages {
-		if isBuilderStage(stage) {
-			if len(stage.Runs) > 0 {
-				// Combine relevant build commands
-				var commands []string
-				for _, run := range stage.Runs {
-					// Filter out package installations (they go in dependencies)
-					if !strings.Contains(run, "apt-get") &&
-						!strings.Contains(run, "yum install") &&
-						!strings.Contains(run, "tdnf install") {
-						commands = append(commands, run)
-					}
+	for _, stage := range builderStages(info) {
+		for _, run := range stage.Runs {
+			cmd, dropped := runScript(run, available)
+			// Package installations go in dependencies, not build steps
+			for _, d := range dropped {
+				if _, ok := d.PackageInstall(); ok {
+					diags.Infof(at(info, run.Location), "packages of %q moved to dependencies.build", truncateCommand(d.Text.Expanded))
+				} else if !isHousekeeping(d) {
+					diags.Warnf(at(info, run.Location), "could not translate package manager command %q, add it to dependencies manually", truncateCommand(d.Text.Expanded))
 				}
+			}
+			if cmd == "" {
+				continue
+			}
 
-				if len(commands) > 0 {
-					// Add workdir context if needed
-					cmd := strings.Join(commands, "\n")
-					if stage.Workdir != "" && !strings.Contains(cmd, "cd ") {
-						cmd = "cd " + stage.Workdir + "\n" + cmd
-					}
+			if tools := buildToolNames(run); len(tools) > 0 {
+				diags.Infof(at(info, run.Location), "build step %d in stage %q runs %s", len(steps)+1, stageLabel(stage), strings.Join(tools, ", "))
+			} else {
+				diags.Infof(at(info, run.Location), "build step %d in stage %q", len(steps)+1, stageLabel(stage))
+			}
 
-					steps = append(steps, map[string]interface{}{
-						"command": cmd,
-					})
-				}
+			// Every step starts in a fresh shell, enter the WORKDIR of the RUN
+			if run.Workdir.Expanded != "" {
+				cmd = "cd " + run.Workdir.Expanded + "\n" + cmd
 			}
+			steps = append(steps, map[string]interface{}{
+				"command": cmd,
+			})
 		}
 	}
 
 	return steps
 }
 
-// extractArtifacts identifies build artifacts
-func extractArtifacts(info *parser.DockerfileInfo) map[string]interface{} {
-	artifacts := make(map[string]interface{})
-	binaries := make(map[string]interface{})
-
-	// Find binaries from COPY --from=builder in final stages
-	builderName := findBuilderStageName(info)
+// extractCaches converts cache mounts from builder stages to Dalec build caches
+// Secret and ssh mounts have no Dalec equivalent, so they only produce a warning
+func extractCaches(info *parser.DockerfileInfo, packageName string, diags *diagnostics.Collector) []map[string]interface{} {
+	var caches []map[string]interface{}
+	seen := make(map[string]bool)
+	hasGoBuildCache := false
 
-	for i := len(info.Stages) - 1; i >= 0; i-- {
-		stage := info.Stages[i]
+	for _, stage := range builderStages(info) {
+		for _, run := range stage.Runs {
+			for _, mount := range run.Mounts {
+				switch mount.Type {
+				case "cache":
+					// Dalec has a dedicated cache type for the Go build cache
+					if strings.Contains(mount.Target, "go-build") {
+						if !hasGoBuildCache {
+							caches = append(caches, map[string]interface{}{
+								"gobuild": map[string]interface{}{},
+							})
+							hasGoBuildCache = true
+						}
+						continue
+					}
 
-		// Skip builder stages, look at final stages
-		if isBuilderStage(stage) {
-			continue
-		}
+					if seen[mount.Target] {
+						continue
+					}
+					seen[mount.Target] = true
 
-		for _, copy := range stage.Copies {
-			if copy.From == builderName || copy.From == "builder" {
-				for _, src := range copy.Source {
-					// Check if it's a binary path
-					if strings.Contains(src, "/bin/") || strings.HasSuffix(src, ".exe") {
-						binaries[src] = map[string]interface{}{}
+					dir := map[string]interface{}{
+						"key":  cacheKey(packageName, mount),
+						"dest": mount.Target,
 					}
+					if mount.Sharing != "" {
+						dir["sharing"] = mount.Sharing
+					}
+					caches = append(caches, map[string]interface{}{"dir": dir})
+
+				case "secret", "ssh":
+					diags.Warnf(at(info, run.Location), "could not translate RUN --mount=type=%s (id %q), Dalec builds have no equivalent: %s",
+						mount.Type, mount.ID, truncateCommand(run.Command.Expanded))
 				}
 			}
 		}
 	}
 
+	return caches
+}
+
+// cacheKey returns the key of a cache directory: the mount id, or without one
+// (buildkit then uses the target path) the package name and the path, e.g.
+// /go/pkg/mod → myapp-go-pkg-mod
+func cacheKey(packageName string, mount parser.Mount) string {
+	if mount.ID != mount.Target {
+		return mount.ID
+	}
+
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(mount.Target) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	suffix := strings.TrimSuffix(b.String(), "-")
+
+	if packageName == "" {
+		return suffix
+	}
+	if suffix == "" {
+		return packageName
+	}
+	return packageName + "-" + suffix
+}
+
+// extractArtifacts identifies build artifacts
+func extractArtifacts(info *parser.DockerfileInfo, inlineFiles []inlineFile, contributions []Contribution, diags *diagnostics.Collector) map[string]interface{} {
+	artifacts := make(map[string]interface{})
+
+	// Find binaries copied out of builder stages into the runtime stages
+	binaries := builderBinaries(info)
 	if len(binaries) > 0 {
 		artifacts["binaries"] = binaries
 	}
 
+	// Language-specific artifacts (libexec, dataDirs, libs, ...) from the detectors
+	for _, c := range contributions {
+		for kind, entries := range c.Artifacts {
+			section, ok := artifacts[kind].(map[string]interface{})
+			if !ok {
+				section = make(map[string]interface{})
+				artifacts[kind] = section
+			}
+			for src, config := range entries {
+				if _, exists := section[src]; !exists {
+					section[src] = config
+				}
+			}
+		}
+	}
+
+	configFiles := configFileArtifacts(info, inlineFiles, diags)
+	if len(configFiles) > 0 {
+		artifacts["configFiles"] = configFiles
+	}
+
+	// Every file copied out of a builder stage should end up in the package
+	roles := rolesOf(info)
+	for _, stage := range runtimeStages(info) {
+		for _, copy := range stage.Copies {
+			if !roles.copiesFromBuilder(copy) {
+				continue
+			}
+			for _, src := range copy.Source {
+				switch {
+				case binaries[src.Expanded] != nil:
+					diags.Infof(at(info, copy.Location), "artifacts.binaries %s", src.Expanded)
+				case !hasArtifact(artifacts, src.Expanded):
+					diags.Warnf(at(info, copy.Location), "COPY --from=%s %s %s is not packaged, add it to artifacts manually",
+						copy.From, src.Expanded, copy.Dest.Expanded)
+				}
+			}
+		}
+	}
+
 	// Add licenses placeholder
 	// artifacts["licenses"] = map[string]interface{}{
 	// 	"# TODO: Add LICENSE file path": map[string]interface{}{},
@@ -439,25 +794,11 @@ func extractArtifacts(info *parser.DockerfileInfo) map[string]interface{} {
 }
 
 // extractImageConfig extracts final image configuration
-func extractImageConfig(info *parser.DockerfileInfo) map[string]interface{} {
+func extractImageConfig(info *parser.DockerfileInfo, diags *diagnostics.Collector) map[string]interface{} {
 	image := make(map[string]interface{})
 
-	if len(info.Stages) == 0 {
-		return image
-	}
-
-	// Find the final Linux stage (skip Windows)
-	var finalStage *parser.Stage
-	for i := len(info.Stages) - 1; i >= 0; i-- {
-		stage := &info.Stages[i]
-		if stage.Name != "windows" && stage.Name != "hpc" {
-			if len(stage.Entrypoint) > 0 || len(stage.Copies) > 0 {
-				finalStage = stage
-				break
-			}
-		}
-	}
-
+	// The target stage is the image being built
+	finalStage := info.TargetStage()
 	if finalStage == nil {
 		return image
 	}
@@ -472,8 +813,29 @@ func extractImageConfig(info *parser.DockerfileInfo) map[string]interface{} {
 		image["entrypoint"] = entrypoint
 	}
 
+	// Runtime settings supported by the Dalec image section
+	if finalStage.User.Expanded != "" {
+		image["user"] = finalStage.User.Expanded
+	}
+
+	if len(finalStage.Volumes) > 0 {
+		volumes := make(map[string]interface{})
+		for _, volume := range finalStage.Volumes {
+			volumes[volume] = map[string]interface{}{}
+		}
+		image["volumes"] = volumes
+	}
+
+	if finalStage.StopSignal != "" {
+		image["stop_signal"] = finalStage.StopSignal
+	}
+
+	if hc := finalStage.Healthcheck; hc != nil && !hc.Disabled {
+		diags.Warnf(at(info, hc.Location), "could not translate HEALTHCHECK, Dalec images have no equivalent; configure it where the image is deployed")
+	}
+
 	// Create symlinks for binaries if needed
-	post := createSymlinks(finalStage)
+	post := createSymlinks(info, finalStage)
 	if len(post) > 0 {
 		image["post"] = post
 	}
@@ -482,19 +844,21 @@ func extractImageConfig(info *parser.DockerfileInfo) map[string]interface{} {
 }
 
 // createSymlinks creates symlink configuration for binaries
-func createSymlinks(stage *parser.Stage) map[string]interface{} {
+func createSymlinks(info *parser.DockerfileInfo, stage *parser.Stage) map[string]interface{} {
 	post := make(map[string]interface{})
 	symlinks := make(map[string]interface{})
 
+	roles := rolesOf(info)
 	for _, copy := range stage.Copies {
-		if copy.From == "builder" || strings.Contains(copy.From, "build") {
+		if roles.copiesFromBuilder(copy) {
 			for _, src := range copy.Source {
-				if strings.Contains(src, "/bin/") && strings.Contains(copy.Dest, "/usr/local/bin/") {
+				dest := copy.Dest.Expanded
+				if strings.Contains(src.Expanded, "/bin/") && strings.Contains(dest, "/usr/local/bin/") {
 					// Create symlink from standard location to actual location
-					binaryName := filepath.Base(src)
-					destPath := filepath.Join(copy.Dest, binaryName)
-					if !strings.HasSuffix(copy.Dest, binaryName) {
-						destPath = copy.Dest
+					binaryName := filepath.Base(src.Expanded)
+					destPath := filepath.Join(dest, binaryName)
+					if !strings.HasSuffix(dest, binaryName) {
+						destPath = dest
 					}
 
 					symlinks["/usr/bin/"+binaryName] = map[string]interface{}{
@@ -514,24 +878,131 @@ func createSymlinks(stage *parser.Stage) map[string]interface{} {
 
 // Helper functions
 
-func isBuilderStage(stage parser.Stage) bool {
-	name := strings.ToLower(stage.Name)
-	return name == "builder" || strings.Contains(name, "build")
+// isBinaryPath reports whether a path copied out of a builder stage is an executable:
+// anything under a bin directory, Windows executables and cargo release builds
+func isBinaryPath(p string) bool {
+	return strings.Contains(p, "/bin/") || strings.HasSuffix(p, ".exe") || isCargoBinary(p)
+}
+
+// isBinaryDest reports whether a COPY destination is a bin or sbin directory
+// or a file in one: /usr/local/bin/app, /usr/bin/, /sbin
+func isBinaryDest(dest string) bool {
+	isBinDir := func(p string) bool {
+		base := path.Base(p)
+		return base == "bin" || base == "sbin"
+	}
+
+	dir := strings.TrimSuffix(dest, "/")
+	return isBinDir(dir) || (!strings.HasSuffix(dest, "/") && isBinDir(path.Dir(dir)))
+}
+
+// hasArtifact reports whether src or a path inside or around it is listed in any artifacts section
+func hasArtifact(artifacts map[string]interface{}, src string) bool {
+	src = strings.TrimSuffix(src, "/")
+	for _, section := range artifacts {
+		entries, _ := section.(map[string]interface{})
+		for p := range entries {
+			p = strings.TrimSuffix(p, "/")
+			if p == src || strings.HasPrefix(p, src+"/") || strings.HasPrefix(src, p+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// builderBinaries returns the binaries copied out of builder stages into the runtime stages
+func builderBinaries(info *parser.DockerfileInfo) map[string]interface{} {
+	binaries := make(map[string]interface{})
+
+	roles := rolesOf(info)
+	for _, stage := range runtimeStages(info) {
+		for _, copy := range stage.Copies {
+			if !roles.copiesFromBuilder(copy) {
+				continue
+			}
+			dest := copy.Dest.Expanded
+			for _, src := range copy.Source {
+				// A binary by its build path, or by where the image installs it
+				if !isBinaryPath(src.Expanded) && !isBinaryDest(dest) {
+					continue
+				}
+				config := map[string]interface{}{}
+				// COPY /out/server /usr/bin/app installs the binary as app
+				if name := path.Base(dest); len(copy.Source) == 1 && !strings.HasSuffix(dest, "/") &&
+					name != "bin" && name != "sbin" && name != path.Base(src.Expanded) && isBinaryDest(dest) {
+					config["name"] = name
+				}
+				binaries[src.Expanded] = config
+			}
+		}
+	}
+
+	return binaries
 }
 
-func hasGoModules(stage parser.Stage) bool {
-	for _, run := range stage.Runs {
-		if strings.Contains(run, "go build") || strings.Contains(run, "go mod") {
+// hasBinaryNamed reports whether a binary artifact with the given file name exists
+func hasBinaryNamed(binaries map[string]interface{}, name string) bool {
+	for src := range binaries {
+		if filepath.Base(src) == name {
 			return true
 		}
 	}
 	return false
 }
 
+// hasGenerator reports whether a source generator of the same type is already listed
+func hasGenerator(generate []map[string]interface{}, generator map[string]interface{}) bool {
+	for _, g := range generate {
+		for name := range generator {
+			if _, ok := g[name]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// truncateCommand shortens a command for warning messages
+func truncateCommand(cmd string) string {
+	if len(cmd) <= 60 {
+		return cmd
+	}
+	return cmd[:57] + "..."
+}
+
+// at converts a parser location into a diagnostic position in the parsed Dockerfile
+func at(info *parser.DockerfileInfo, loc parser.Location) diagnostics.Position {
+	return diagnostics.Position{
+		File:      info.Path,
+		StartLine: loc.StartLine,
+		EndLine:   loc.EndLine,
+		Source:    loc.Original,
+	}
+}
+
+// reportWarnings adds buildkit parser warnings and lint findings to the diagnostics
+func reportWarnings(info *parser.DockerfileInfo, diags *diagnostics.Collector) {
+	warnings := append([]parser.Warning{}, info.Warnings...)
+	warnings = append(warnings, parser.Lint(info)...)
+
+	for _, w := range warnings {
+		diags.Warnf(at(info, w.Location), "%s [%s]", w.Message, w.Rule)
+	}
+}
+
+// stageLabel names a stage for messages: its AS name or its index
+func stageLabel(stage parser.Stage) string {
+	if stage.Name != "" {
+		return stage.Name
+	}
+	return strconv.Itoa(stage.Index)
+}
+
 func deriveSourceName(stage parser.Stage) string {
 	// Try to derive from workdir
-	if stage.Workdir != "" {
-		name := filepath.Base(stage.Workdir)
+	if stage.Workdir.Expanded != "" {
+		name := filepath.Base(stage.Workdir.Expanded)
 		if name != "" && name != "/" && name != "." {
 			return name
 		}
@@ -539,17 +1010,6 @@ func deriveSourceName(stage parser.Stage) string {
 	return "source"
 }
 
-func findBuilderStageName(info *parser.DockerfileInfo) string {
-	for _, stage := range info.Stages {
-		if isBuilderStage(stage) {
-			if stage.Name != "" {
-				return stage.Name
-			}
-		}
-	}
-	return "builder"
-}
-
 func getArgValueOrDefault(info *parser.DockerfileInfo, key string, defaultValue any) any {
 	if info == nil {
 		return fmt.Sprintf("%v", defaultValue)
@@ -559,9 +1019,44 @@ func getArgValueOrDefault(info *parser.DockerfileInfo, key string, defaultValue
 		return val
 	}
 
+	// Fall back to ARGs declared inside a stage
+	for _, stage := range info.Stages {
+		if val, exists := stage.Args[key]; exists && val != "" {
+			return val
+		}
+	}
+
 	return defaultValue
 }
 
+// specArgNames returns the args declared in the generated spec's args section
+func specArgNames() map[string]bool {
+	return map[string]bool{
+		"REVISION":   true,
+		"VERSION":    true,
+		"COMMIT":     true,
+		"TARGETARCH": true,
+		"TARGETOS":   true,
+	}
+}
+
+// pickWord chooses between the raw and expanded form of a Dockerfile value
+// The raw form is kept when every variable it references is also available in
+// the Dalec build, so the spec stays parameterised instead of hard-coding values
+func pickWord(w parser.Word, available map[string]bool) string {
+	refs := w.References()
+	if len(refs) == 0 {
+		return w.Expanded
+	}
+
+	for _, ref := range refs {
+		if !available[ref] {
+			return w.Expanded
+		}
+	}
+	return w.Raw
+}
+
 // Path-based helper functions for nested map manipulation
 
 // Set sets a nested value using dot notation path
@@ -0,0 +1,284 @@
+package transformer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"dalec-mapping/diagnostics"
+	"dalec-mapping/parser"
+)
+
+// parseDockerfile parses a Dockerfile written to a temporary directory
+func parseDockerfile(t *testing.T, content string) *parser.DockerfileInfo {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := parser.ParseDockerfile(path, parser.ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+// transform generates a spec for a Dockerfile with the given repository metadata
+func transform(t *testing.T, repo *RepoMetadata, dockerfile string) (DalecSpec, *diagnostics.Collector) {
+	t.Helper()
+	return TransformToDalec(repo, PreviousDalecSpec{}, parseDockerfile(t, dockerfile), Options{})
+}
+
+func TestSourceNamesDoNotCollide(t *testing.T) {
+	repo := &RepoMetadata{RepoName: "hello", GitURL: "https://github.com/owner/hello", Commit: "abc"}
+	spec, _ := transform(t, repo, `FROM golang:1.22 AS build
+WORKDIR /src
+RUN go build -o /out/hello .
+
+FROM mcr.microsoft.com/azurelinux/base/core:3.0
+COPY <<EOF /etc/hello
+greeting=hi
+EOF
+COPY --from=busybox:1.36 /bin/hello /bin/
+COPY --from=build /out/hello /usr/bin/hello
+`)
+
+	sources := spec["sources"].(map[string]interface{})
+	git, ok := sources["hello"].(map[string]interface{})
+	if !ok || git["git"] == nil {
+		t.Fatalf("git source hello was overwritten: %v", sources["hello"])
+	}
+	if _, ok := sources["hello-2"].(map[string]interface{})["inline"]; !ok {
+		t.Errorf("inline source not renamed to hello-2: %v", sources)
+	}
+	if _, ok := sources["busybox-hello"].(map[string]interface{})["image"]; !ok {
+		t.Errorf("image source busybox-hello missing: %v", sources)
+	}
+
+	// The config file artifact refers to the renamed source and keeps the file name
+	configFiles := spec["artifacts"].(map[string]interface{})["configFiles"].(map[string]interface{})
+	artifact, ok := configFiles["hello-2"].(map[string]interface{})
+	if !ok || artifact["name"] != "hello" {
+		t.Errorf("configFiles = %v, want hello-2 named hello", configFiles)
+	}
+}
+
+func TestUniqueSourceName(t *testing.T) {
+	used := map[string]bool{"app": true}
+	for _, want := range []string{"app-2", "app-3"} {
+		if got := uniqueSourceName("app", used); got != want {
+			t.Errorf("uniqueSourceName(app) = %q, want %q", got, want)
+		}
+	}
+	if got := uniqueSourceName("other", used); got != "other" {
+		t.Errorf("uniqueSourceName(other) = %q", got)
+	}
+}
+
+func TestDockerfilePath(t *testing.T) {
+	checkout := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		repo RepoFiles
+		want string
+	}{
+		{"inside the checkout", filepath.Join(checkout, "build", "Dockerfile"), DirFiles(checkout), "build/Dockerfile"},
+		{"outside the checkout", filepath.Join(t.TempDir(), "Dockerfile.prod"), DirFiles(checkout), "Dockerfile.prod"},
+		{"relative without checkout", "Dockerfile", nil, "Dockerfile"},
+		{"absolute under the working directory", filepath.Join(cwd, "testdata", "Dockerfile"), mapFiles{}, "testdata/Dockerfile"},
+	}
+
+	for _, tt := range tests {
+		if got := dockerfilePath(tt.path, tt.repo); got != tt.want {
+			t.Errorf("%s: dockerfilePath(%s) = %q, want %q", tt.name, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestBuilderCopyArtifacts(t *testing.T) {
+	tests := []struct {
+		name     string
+		copy     string
+		want     map[string]interface{} // artifacts.binaries
+		wantWarn bool                   // not packaged warning
+	}{
+		{
+			name: "bin directory source",
+			copy: "COPY --from=build /go/bin/app /app",
+			want: map[string]interface{}{"/go/bin/app": map[string]interface{}{}},
+		},
+		{
+			name: "bin directory destination",
+			copy: "COPY --from=build /out/app /usr/local/bin/app",
+			want: map[string]interface{}{"/out/app": map[string]interface{}{}},
+		},
+		{
+			name: "renamed into sbin",
+			copy: "COPY --from=build /out/server /usr/sbin/appd",
+			want: map[string]interface{}{"/out/server": map[string]interface{}{"name": "appd"}},
+		},
+		{
+			name: "into a bin directory",
+			copy: "COPY --from=build /out/app /out/tool /usr/bin/",
+			want: map[string]interface{}{"/out/app": map[string]interface{}{}, "/out/tool": map[string]interface{}{}},
+		},
+		{
+			name:     "not packaged",
+			copy:     "COPY --from=build /out/app.json /etc/app/app.json",
+			wantWarn: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, diags := transform(t, &RepoMetadata{RepoName: "app"}, `FROM mcr.microsoft.com/azurelinux/base/core:3.0 AS build
+RUN make
+
+FROM mcr.microsoft.com/azurelinux/base/core:3.0
+`+tt.copy+"\n")
+
+			binaries, _ := spec["artifacts"].(map[string]interface{})["binaries"].(map[string]interface{})
+			if len(binaries) != len(tt.want) || (len(tt.want) > 0 && !reflect.DeepEqual(binaries, tt.want)) {
+				t.Errorf("artifacts.binaries = %v, want %v", binaries, tt.want)
+			}
+
+			warned := false
+			for _, d := range diags.Items() {
+				if d.Severity == diagnostics.Warning && strings.Contains(d.Message, "is not packaged") {
+					warned = true
+				}
+			}
+			if warned != tt.wantWarn {
+				t.Errorf("not packaged warning = %v, want %v", warned, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestVersionAndRevision(t *testing.T) {
+	const dockerfile = "FROM golang:1.22\nRUN go build ./...\n"
+
+	tests := []struct {
+		name         string
+		repo         *RepoMetadata
+		previous     PreviousDalecSpec
+		wantVersion  string
+		wantRevision string
+		wantWarn     bool
+	}{
+		{
+			name:         "first generation",
+			repo:         &RepoMetadata{Commit: "abc", Version: "1.2.0"},
+			wantVersion:  "1.2.0",
+			wantRevision: "1",
+		},
+		{
+			name:         "rebuild bumps the revision",
+			repo:         &RepoMetadata{Commit: "abc", Version: "1.2.0"},
+			previous:     PreviousDalecSpec{Commit: "abc", Version: "1.2.0", Revision: "2"},
+			wantVersion:  "1.2.0",
+			wantRevision: "3",
+		},
+		{
+			name:         "rebuild without a version source keeps the previous version",
+			repo:         &RepoMetadata{Commit: "abc"},
+			previous:     PreviousDalecSpec{Commit: "abc", Version: "1.2.0", Revision: "2"},
+			wantVersion:  "1.2.0",
+			wantRevision: "3",
+		},
+		{
+			name:         "new commit and tag",
+			repo:         &RepoMetadata{Commit: "def", Version: "1.3.0"},
+			previous:     PreviousDalecSpec{Commit: "abc", Version: "1.2.0", Revision: "4"},
+			wantVersion:  "1.3.0",
+			wantRevision: "1",
+		},
+		{
+			name:         "new commit without a version source",
+			repo:         &RepoMetadata{Commit: "def"},
+			previous:     PreviousDalecSpec{Commit: "abc", Version: "1.2.0", Revision: "4"},
+			wantVersion:  "1.2.0",
+			wantRevision: "1",
+			wantWarn:     true,
+		},
+		{
+			name:         "new version at the same commit",
+			repo:         &RepoMetadata{Commit: "abc", Version: "1.2.1"},
+			previous:     PreviousDalecSpec{Commit: "abc", Version: "1.2.0", Revision: "4"},
+			wantVersion:  "1.2.1",
+			wantRevision: "1",
+		},
+		{
+			name:         "invalid previous revision",
+			repo:         &RepoMetadata{Commit: "abc", Version: "1.2.0"},
+			previous:     PreviousDalecSpec{Commit: "abc", Version: "1.2.0", Revision: "x"},
+			wantVersion:  "1.2.0",
+			wantRevision: "1",
+			wantWarn:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.repo.RepoName = "app"
+			spec, diags := TransformToDalec(tt.repo, tt.previous, parseDockerfile(t, dockerfile), Options{})
+
+			args := spec["args"].(map[string]interface{})
+			if args["VERSION"] != tt.wantVersion || args["REVISION"] != tt.wantRevision {
+				t.Errorf("VERSION, REVISION = %v, %v; want %s, %s", args["VERSION"], args["REVISION"], tt.wantVersion, tt.wantRevision)
+			}
+
+			warned := false
+			for _, d := range diags.Items() {
+				if d.Severity == diagnostics.Warning && (strings.Contains(d.Message, "COMMIT changed") || strings.Contains(d.Message, "revision")) {
+					warned = true
+				}
+			}
+			if warned != tt.wantWarn {
+				t.Errorf("warning = %v, want %v", warned, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	tests := []struct {
+		id, target string
+		want       string
+	}{
+		{"gomod", "/go/pkg/mod", "gomod"},
+		{"/go/pkg/mod", "/go/pkg/mod", "app-go-pkg-mod"}, // no id: buildkit uses the target
+		{"/root/.cache/pip", "/root/.cache/pip", "app-root-cache-pip"},
+		{"/", "/", "app"},
+	}
+
+	for _, tt := range tests {
+		if got := cacheKey("app", parser.Mount{Type: "cache", ID: tt.id, Target: tt.target}); got != tt.want {
+			t.Errorf("cacheKey(id %q, target %q) = %q, want %q", tt.id, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestCacheMountWithoutID(t *testing.T) {
+	spec, _ := transform(t, &RepoMetadata{RepoName: "app"}, `FROM mcr.microsoft.com/azurelinux/base/core:3.0 AS build
+RUN --mount=type=cache,target=/var/cache/ccache make
+
+FROM mcr.microsoft.com/azurelinux/base/core:3.0
+COPY --from=build /src/bin/app /usr/bin/app
+`)
+
+	caches := spec["build"].(map[string]interface{})["caches"].([]map[string]interface{})
+	dir := caches[0]["dir"].(map[string]interface{})
+	if dir["key"] != "app-var-cache-ccache" || dir["dest"] != "/var/cache/ccache" {
+		t.Errorf("cache dir = %v, want key app-var-cache-ccache at /var/cache/ccache", dir)
+	}
+}
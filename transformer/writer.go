@@ -4,63 +4,220 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 type PreviousDalecSpec struct {
-	// Comparison Fields
-	Commit string
+	// Comparison Fields, read from args.COMMIT and args.VERSION
+	Commit  string
+	Version string
 
-	// Updatable Fields
+	// Updatable Fields, read from args.REVISION
 	Revision string
+
+	// Full contents for the three-way merge (see MergePrevious)
+	Path     string
+	Spec     DalecSpec // The previous spec, possibly edited by hand
+	Baseline DalecSpec // What was generated last time, nil without a sidecar (see ReadBaseline)
+
+	baselinePath string     // Sidecar the baseline was looked up in
+	document     *yaml.Node // Parsed previous spec, to report conflicts with line numbers
 }
 
 // ReadYAML reads a DalecSpec file and unmarshal updated values
+// The baseline is not read, see ReadBaseline
 func ReadYAML(path string) (PreviousDalecSpec, error) {
-	data := PreviousDalecSpec{}
+	data := PreviousDalecSpec{Path: path}
 
-	// TODO: populate fields from previous spec file.
 	// Read file content
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return data, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	// Unmarshal YAML content
-	if err := yaml.Unmarshal(content, &data); err != nil {
+	// Unmarshal YAML content, keeping the whole spec with its hand edits
+	data.document = &yaml.Node{}
+	if err := yaml.Unmarshal(content, data.document); err != nil {
+		return data, fmt.Errorf("failed to unmarshal YAML: %w", err)
+	}
+	// Decode into a plain map: yaml.v3 would make nested maps DalecSpecs too
+	var fields map[string]interface{}
+	if err := data.document.Decode(&fields); err != nil {
 		return data, fmt.Errorf("failed to unmarshal YAML: %w", err)
 	}
+	data.Spec = DalecSpec(fields)
+
+	// Dalec keeps the release bookkeeping in args; version/revision refer to them
+	if args, ok := data.Spec["args"].(map[string]interface{}); ok {
+		data.Commit = argString(args, "COMMIT")
+		data.Version = argString(args, "VERSION")
+		data.Revision = argString(args, "REVISION")
+	}
 
 	return data, nil
 }
 
-// WriteYAML converts DalecSpec to formatted YAML
+// ReadBaseline reads the baseline from the sidecar of the spec that is about
+// to be written (see BaselinePath). WriteBaseline keeps the sidecar next to the
+// output, so the output path is passed here, not the path of the previous spec;
+// the two are the same when a spec is regenerated in place
+// A missing sidecar is not an error, Baseline stays nil
+func (p *PreviousDalecSpec) ReadBaseline(outputPath string) error {
+	p.baselinePath = BaselinePath(outputPath)
+
+	content, err := os.ReadFile(p.baselinePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read baseline: %w", err)
+	}
+
+	var fields map[string]interface{}
+	if err := yaml.Unmarshal(content, &fields); err != nil {
+		return fmt.Errorf("failed to unmarshal baseline %s: %w", p.baselinePath, err)
+	}
+	p.Baseline = DalecSpec(fields)
+	return nil
+}
+
+// argString returns an args value as a string; unquoted numbers such as REVISION: 2 are accepted
+func argString(args map[string]interface{}, key string) string {
+	if v, ok := args[key]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// root returns the top-level mapping node of the previous spec, nil if it was not read from a file
+func (p PreviousDalecSpec) root() *yaml.Node {
+	if p.document == nil || len(p.document.Content) == 0 {
+		return nil
+	}
+	return p.document.Content[0]
+}
+
+// baselineFile returns the sidecar the baseline was (or would be) read from
+func (p PreviousDalecSpec) baselineFile() string {
+	if p.baselinePath != "" {
+		return p.baselinePath
+	}
+	return BaselinePath(p.Path)
+}
+
+// BaselinePath returns the sidecar that keeps the last generated version of a spec:
+// spec.yml → spec.generated.yml
+func BaselinePath(specPath string) string {
+	ext := filepath.Ext(specPath)
+	return strings.TrimSuffix(specPath, ext) + ".generated" + ext
+}
+
+// WriteBaseline writes the generated spec (before merging hand edits) to the sidecar of specPath,
+// the path the spec is written to
+func WriteBaseline(specPath string, generated DalecSpec) error {
+	content, err := WriteYAML(generated)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(BaselinePath(specPath), []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write baseline: %w", err)
+	}
+	return nil
+}
+
+// DefaultSectionOrder is the order of the top-level keys in Dalec specs
+// Keys that are not listed (e.g. x-* extensions) follow in alphabetical order
+var DefaultSectionOrder = []string{
+	"name",
+	"description",
+	"website",
+	"license",
+	"vendor",
+	"packager",
+	"version",
+	"revision",
+	"noarch",
+	"args",
+	"sources",
+	"patches",
+	"dependencies",
+	"provides",
+	"replaces",
+	"conflicts",
+	"targets",
+	"build",
+	"artifacts",
+	"image",
+	"tests",
+	"changelog",
+}
+
+// WriteOptions controls how the spec is serialized
+type WriteOptions struct {
+	SectionOrder []string // Top-level key order (default: DefaultSectionOrder)
+}
+
+// WriteYAML converts DalecSpec to formatted YAML in the canonical Dalec section order
 func WriteYAML(spec DalecSpec) (string, error) {
+	return WriteYAMLWithOptions(spec, WriteOptions{})
+}
+
+// WriteYAMLWithOptions converts DalecSpec to formatted YAML
+// Nested maps are always written with sorted keys, so regenerating a spec gives minimal diffs
+func WriteYAMLWithOptions(spec DalecSpec, opts WriteOptions) (string, error) {
+	if opts.SectionOrder == nil {
+		opts.SectionOrder = DefaultSectionOrder
+	}
+
+	// Refuse to write a spec the Dalec frontend would reject
+	if err := spec.Validate(); err != nil {
+		return "", fmt.Errorf("invalid spec: %w", err)
+	}
+
 	// Create buffer for output
 	var buf bytes.Buffer
 
 	// Handle syntax header specially (needs to be first, with special format)
-	if syntax, ok := spec["# syntax"]; ok {
+	if syntax, ok := spec[syntaxKey]; ok {
 		buf.WriteString(fmt.Sprintf("# syntax=%v\n\n", syntax))
+	}
 
-		// Create a copy without the syntax line for yaml encoding
-		specCopy := make(DalecSpec)
-		for k, v := range spec {
-			if k != "# syntax" {
-				specCopy[k] = v
-			}
+	// Provenance and other header comments follow the syntax line
+	if header, _ := spec[headerKey].([]string); len(header) > 0 {
+		for _, line := range header {
+			buf.WriteString("# " + line + "\n")
 		}
-		spec = specCopy
+		buf.WriteString("\n")
 	}
 
+	// Create a copy without the comment keys for yaml encoding
+	specCopy := make(map[string]interface{})
+	for k, v := range spec {
+		if !isCommentKey(k) {
+			specCopy[k] = v
+		}
+	}
+
+	// Build the node tree; yaml.v3 sorts the keys of every map it encodes
+	var root yaml.Node
+	if err := root.Encode(specCopy); err != nil {
+		return "", fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	orderSections(&root, opts.SectionOrder)
+	comments, _ := spec[commentsKey].([]specComment)
+	applyComments(&root, comments)
+
 	// Create YAML encoder with proper indentation
 	encoder := yaml.NewEncoder(&buf)
 	encoder.SetIndent(2)
 
 	// Encode the spec
-	if err := encoder.Encode(spec); err != nil {
+	if err := encoder.Encode(&root); err != nil {
 		return "", fmt.Errorf("failed to encode YAML: %w", err)
 	}
 
@@ -73,20 +230,51 @@ func WriteYAML(spec DalecSpec) (string, error) {
 	return result, nil
 }
 
-// formatDalecYAML applies Dalec-specific formatting
+// orderSections reorders the key/value pairs of a mapping node: keys in order
+// come first, in that order, the rest keep their (sorted) position after them
+func orderSections(mapping *yaml.Node, order []string) {
+	if mapping.Kind != yaml.MappingNode {
+		return
+	}
+
+	rank := make(map[string]int, len(order))
+	for i, key := range order {
+		rank[key] = i
+	}
+
+	// Content alternates key and value nodes
+	type pair struct{ key, value *yaml.Node }
+	pairs := make([]pair, 0, len(mapping.Content)/2)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		pairs = append(pairs, pair{mapping.Content[i], mapping.Content[i+1]})
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		ri, iKnown := rank[pairs[i].key.Value]
+		rj, jKnown := rank[pairs[j].key.Value]
+		if iKnown && jKnown {
+			return ri < rj
+		}
+		return iKnown && !jKnown
+	})
+
+	mapping.Content = mapping.Content[:0]
+	for _, p := range pairs {
+		mapping.Content = append(mapping.Content, p.key, p.value)
+	}
+}
+
+// formatDalecYAML applies Dalec-specific formatting: a blank line before every
+// top-level section, while consecutive top-level scalars (name, version, ...) stay together
 func formatDalecYAML(yamlStr string) string {
 	lines := strings.Split(yamlStr, "\n")
 	var formatted []string
 
 	for i, line := range lines {
-		// Add blank line before major sections
-		if i > 0 && !strings.HasPrefix(line, " ") && line != "" {
-			trimmedLine := strings.TrimSpace(line)
-			if trimmedLine != "" && !strings.HasPrefix(lines[i-1], " ") {
-				// Check if previous line was not empty and not indented
-				if i > 0 && strings.TrimSpace(lines[i-1]) != "" {
-					formatted = append(formatted, "")
-				}
+		if i > 0 && isTopLevel(line) && strings.TrimSpace(lines[i-1]) != "" {
+			section := strings.HasSuffix(line, ":")
+			if section || !isTopLevel(lines[i-1]) {
+				formatted = append(formatted, "")
 			}
 		}
 
@@ -96,6 +284,11 @@ func formatDalecYAML(yamlStr string) string {
 	return strings.Join(formatted, "\n")
 }
 
+// isTopLevel reports whether a line starts a top-level key
+func isTopLevel(line string) bool {
+	return line != "" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "-")
+}
+
 // MarshalYAML provides custom YAML marshaling for DalecSpec
 func (spec DalecSpec) MarshalYAML() (interface{}, error) {
 	// Return the map directly for standard marshaling
@@ -0,0 +1,85 @@
+package transformer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadBaselineNextToOutput(t *testing.T) {
+	dir := t.TempDir()
+	specPath := filepath.Join(dir, "edited.yml")
+	outputPath := filepath.Join(dir, "spec.yml")
+
+	if err := os.WriteFile(specPath, []byte("name: app\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteBaseline(outputPath, DalecSpec{"name": "app"}); err != nil {
+		t.Fatal(err)
+	}
+
+	previous, err := ReadYAML(specPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous.Baseline != nil {
+		t.Fatalf("ReadYAML read a baseline: %v", previous.Baseline)
+	}
+
+	if err := previous.ReadBaseline(specPath); err != nil || previous.Baseline != nil {
+		t.Errorf("ReadBaseline(spec) = %v, baseline %v; want no sidecar", err, previous.Baseline)
+	}
+	if err := previous.ReadBaseline(outputPath); err != nil || previous.Baseline["name"] != "app" {
+		t.Errorf("ReadBaseline(output) = %v, baseline %v; want the written sidecar", err, previous.Baseline)
+	}
+	if previous.baselineFile() != BaselinePath(outputPath) {
+		t.Errorf("baselineFile = %s, want %s", previous.baselineFile(), BaselinePath(outputPath))
+	}
+}
+
+func TestWriteYAMLSectionOrder(t *testing.T) {
+	spec := DalecSpec{
+		"x-build-extensions": map[string]interface{}{"z": 1, "a": 2},
+		"tests":              []map[string]interface{}{},
+		"build":              map[string]interface{}{"env": map[string]string{"B": "2", "A": "1"}},
+		"args":               map[string]interface{}{"VERSION": "1.0", "COMMIT": "abc"},
+		"license":            "MIT",
+		"name":               "app",
+		"version":            "${VERSION}",
+	}
+
+	tests := []struct {
+		name  string
+		order []string
+		want  []string
+	}{
+		{"default", nil, []string{"name", "license", "version", "args", "build", "tests", "x-build-extensions"}},
+		{"custom", []string{"name", "build"}, []string{"name", "build", "args", "license", "tests", "version", "x-build-extensions"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := WriteYAMLWithOptions(spec, WriteOptions{SectionOrder: tt.order})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var keys []string
+			for _, line := range strings.Split(out, "\n") {
+				if key, _, ok := strings.Cut(line, ":"); ok && line[0] != ' ' && line[0] != '#' {
+					keys = append(keys, key)
+				}
+			}
+			if !reflect.DeepEqual(keys, tt.want) {
+				t.Errorf("sections = %v, want %v", keys, tt.want)
+			}
+
+			// Nested keys are sorted
+			if strings.Index(out, "COMMIT:") > strings.Index(out, "VERSION:") || strings.Index(out, "A: \"1\"") > strings.Index(out, "B: \"2\"") {
+				t.Errorf("nested keys not sorted:\n%s", out)
+			}
+		})
+	}
+}